@@ -0,0 +1,621 @@
+/////////////////////////////////
+// Creating and Extracting Archives (.tar, .tar.gz, .zip) Safely
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+
+// Execute:
+// go run archives.go create backup.tar.gz my_dir     (the format is picked by extension)
+// go run archives.go extract backup.tar.gz out_dir [-max-size 1073741824] [-max-entries 10000]
+// go run archives.go demo                            (creates a malicious archive and shows it's rejected)
+// The tests extract more malicious archives:
+// go test -v archives.go archives_test.go
+
+// An archive comes from someone else, so extracting it is dangerous:
+// - "zip slip": an entry named ../../home/andrei/.bashrc is written outside the destination
+// - an absolute name like /etc/passwd
+// - a symlink pointing outside the destination, followed by a file written "through" it
+// - a decompression bomb: a few KB that expand to many GB, or millions of tiny entries
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/////////////////////////////////
+// Creating Archives
+/////////////////////////////////
+
+// declaring a function that archives a directory; the entries are named relative to the directory
+func createArchive(archivePath, dir string) error {
+	out, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	switch {
+	case strings.HasSuffix(archivePath, ".zip"):
+		err = writeZip(out, dir)
+	case strings.HasSuffix(archivePath, ".tar.gz") || strings.HasSuffix(archivePath, ".tgz"):
+		zw := gzip.NewWriter(out)
+		if err = writeTar(zw, dir); err == nil {
+			err = zw.Close()
+		}
+	case strings.HasSuffix(archivePath, ".tar"):
+		err = writeTar(out, dir)
+	default:
+		err = fmt.Errorf("%s: unknown archive format", archivePath)
+	}
+	if err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func writeTar(w io.Writer, dir string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		fileInfo, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		// tar.FileInfoHeader() copies the mode (0644, 0755, ...), the mtime and the type
+		link := ""
+		if fileInfo.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fileInfo, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if fileInfo.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fileInfo.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func writeZip(w io.Writer, dir string) error {
+	zw := zip.NewWriter(w)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		fileInfo, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		// zip.FileInfoHeader() keeps the mode and the mtime; symlinks are stored with their target as content
+		hdr, err := zip.FileInfoHeader(fileInfo)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if fileInfo.IsDir() {
+			hdr.Name += "/"
+		} else {
+			hdr.Method = zip.Deflate
+		}
+		entry, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		switch {
+		case fileInfo.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(entry, link)
+			return err
+		case fileInfo.Mode().IsRegular():
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = io.Copy(entry, file)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+/////////////////////////////////
+// Extracting Archives Safely
+/////////////////////////////////
+
+// declaring a struct type with the extraction limits
+type limits struct {
+	maxTotalSize int64 // the sum of the extracted file sizes
+	maxFileSize  int64
+	maxEntries   int
+}
+
+var (
+	errUnsafePath  = errors.New("unsafe path")
+	errLimit       = errors.New("archive exceeds limit")
+	errUnsupported = errors.New("unsupported entry type")
+)
+
+// declaring a struct type for an extraction in progress
+type extractor struct {
+	dest    string
+	limits  limits
+	entries int
+	total   int64
+}
+
+// declaring a function that checks an entry name and returns the path to write it to
+func (x *extractor) target(name string) (string, error) {
+	// both / and \ are treated as separators, an archive made on Windows can use \
+	name = strings.ReplaceAll(name, `\`, "/")
+	if name == "" || strings.HasPrefix(name, "/") || filepath.VolumeName(name) != "" ||
+		(len(name) > 1 && name[1] == ':') { // C:/Windows
+		return "", fmt.Errorf("%q: %w (absolute)", name, errUnsafePath)
+	}
+	// filepath.IsLocal() reports whether the path stays inside the current directory: no .., not absolute
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", fmt.Errorf("%q: %w (escapes destination)", name, errUnsafePath)
+	}
+	target := filepath.Join(x.dest, filepath.FromSlash(name))
+
+	// a symlink extracted before could redirect the write: a/ -> /etc, then a/passwd
+	// so every parent directory that exists must really be a directory inside dest.
+	rel, _ := filepath.Rel(x.dest, filepath.Dir(target))
+	p := x.dest
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if part == "." {
+			break
+		}
+		p = filepath.Join(p, part)
+		fileInfo, err := os.Lstat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if fileInfo.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("%q: %w (through symlink %s)", name, errUnsafePath, p)
+		}
+	}
+	return target, nil
+}
+
+// method that checks a symlink: its target, resolved from the link's directory, must stay inside dest.
+// It's resolved like the kernel does, one component at a time, following the links already extracted:
+// with d/l -> .. the target l/.. of d/l2 is not d (lexically) but the parent of dest.
+// After a component that doesn't exist yet, .. is refused: that component could become a symlink later.
+func (x *extractor) checkLink(target, link string) error {
+	if filepath.IsAbs(link) {
+		return fmt.Errorf("symlink %s -> %s: %w (absolute target)", target, link, errUnsafePath)
+	}
+	// the parents of target are real directories, target() checked them
+	p := filepath.Dir(target)
+	missing := false
+	for _, part := range strings.Split(link, "/") {
+		switch {
+		case part == "" || part == ".":
+			continue
+		case part == "..":
+			if missing {
+				return fmt.Errorf("symlink %s -> %s: %w (.. after a missing directory)", target, link, errUnsafePath)
+			}
+			p = filepath.Dir(p)
+		default:
+			p = filepath.Join(p, part)
+			if missing {
+				break
+			}
+			fileInfo, err := os.Lstat(p)
+			if errors.Is(err, fs.ErrNotExist) {
+				missing = true
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if fileInfo.Mode()&fs.ModeSymlink != 0 {
+				// an extracted symlink: it was checked, its real target is inside dest (unless it's dangling)
+				resolved, err := filepath.EvalSymlinks(p)
+				if errors.Is(err, fs.ErrNotExist) {
+					missing = true
+					break
+				}
+				if err != nil {
+					return err
+				}
+				p = resolved
+			}
+		}
+		if rel, err := filepath.Rel(x.dest, p); err != nil || !filepath.IsLocal(rel) && rel != "." {
+			return fmt.Errorf("symlink %s -> %s: %w (escapes destination)", target, link, errUnsafePath)
+		}
+	}
+	return nil
+}
+
+// method that counts an entry against the limit
+func (x *extractor) countEntry() error {
+	x.entries++
+	if x.limits.maxEntries > 0 && x.entries > x.limits.maxEntries {
+		return fmt.Errorf("%w: more than %d entries", errLimit, x.limits.maxEntries)
+	}
+	return nil
+}
+
+// method that writes a file, stopping as soon as a limit is exceeded.
+// the sizes in the headers can lie, so the bytes are counted while they are decompressed.
+func (x *extractor) writeFile(target string, r io.Reader, mode fs.FileMode, mtime time.Time) error {
+	// limit is the number of bytes this file may have, -1 if there is no limit.
+	// Once a limit is set, an exhausted budget (0) means no byte at all, never "unlimited".
+	limit := int64(-1)
+	if x.limits.maxFileSize > 0 {
+		limit = x.limits.maxFileSize
+	}
+	if x.limits.maxTotalSize > 0 && (limit < 0 || x.limits.maxTotalSize-x.total < limit) {
+		limit = x.limits.maxTotalSize - x.total
+		if limit <= 0 {
+			return fmt.Errorf("%w: %s exceeds the total size", errLimit, target)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	// O_EXCL: an existing file (or a symlink planted by the archive) is never overwritten
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	if limit >= 0 {
+		// reading one byte more than allowed tells us that the limit is exceeded
+		r = io.LimitReader(r, limit+1)
+	}
+	n, err := io.Copy(file, r)
+	x.total += n
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && limit >= 0 && n > limit {
+		err = fmt.Errorf("%w: %s is too large (decompression bomb?)", errLimit, target)
+	}
+	if err != nil {
+		os.Remove(target)
+		return err
+	}
+	return os.Chtimes(target, mtime, mtime)
+}
+
+func extractTar(r io.Reader, x *extractor) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := x.countEntry(); err != nil {
+			return err
+		}
+		target, err := x.target(hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, fs.FileMode(hdr.Mode).Perm()|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := x.writeFile(target, tr, fs.FileMode(hdr.Mode), hdr.ModTime); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := x.checkLink(target, hdr.Linkname); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		default:
+			// hard links, devices and FIFOs are skipped, they are rarely needed and easy to abuse
+			log.Printf("skipping %s: %v %q\n", hdr.Name, errUnsupported, hdr.Typeflag)
+		}
+	}
+}
+
+func extractZip(path string, x *extractor) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if err := x.countEntry(); err != nil {
+			return err
+		}
+		target, err := x.target(f.Name)
+		if err != nil {
+			return err
+		}
+		mode := f.Mode()
+
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, mode.Perm()|0700); err != nil {
+				return err
+			}
+		case mode&fs.ModeSymlink != 0:
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			link, err := io.ReadAll(io.LimitReader(rc, 4096))
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			if err := x.checkLink(target, string(link)); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(string(link), target); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = x.writeFile(target, rc, mode, f.Modified)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			log.Printf("skipping %s: %v\n", f.Name, errUnsupported)
+		}
+	}
+	return nil
+}
+
+// declaring a function that extracts an archive into dest, which is created if needed
+func extractArchive(archivePath, dest string, l limits) error {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	// resolving dest itself, so that the checks compare real paths
+	dest, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+	x := &extractor{dest: dest, limits: l}
+
+	if strings.HasSuffix(archivePath, ".zip") {
+		return extractZip(archivePath, x)
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if strings.HasSuffix(archivePath, ".tar.gz") || strings.HasSuffix(archivePath, ".tgz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	return extractTar(r, x)
+}
+
+/////////////////////////////////
+// A Demo with Malicious Archives
+/////////////////////////////////
+
+// a helper function that writes a tar archive with hand-made headers
+func maliciousTar(path string, entries []*tar.Header, content string) {
+	file, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	tw := tar.NewWriter(file)
+	for _, hdr := range entries {
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(content))
+		}
+		tw.WriteHeader(hdr)
+		if hdr.Typeflag == tar.TypeReg {
+			io.WriteString(tw, content)
+		}
+	}
+	tw.Close()
+}
+
+func demo() {
+	dir, err := os.MkdirTemp("", "archives")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := func(name string) string { return filepath.Join(dir, name) }
+	safe := limits{maxTotalSize: 1 << 20, maxFileSize: 1 << 20, maxEntries: 100}
+
+	// A ROUND TRIP: modes, mtimes and symlinks are preserved
+	os.MkdirAll(p("src/bin"), 0755)
+	os.WriteFile(p("src/a.txt"), []byte("I learn Golang!"), 0644)
+	os.WriteFile(p("src/bin/run.sh"), []byte("#!/bin/sh\necho hi\n"), 0755)
+	os.Symlink("a.txt", p("src/link.txt"))
+
+	for _, name := range []string{"backup.tar", "backup.tar.gz", "backup.zip"} {
+		if err := createArchive(p(name), p("src")); err != nil {
+			log.Fatal(err)
+		}
+		out := p("out-" + name)
+		if err := extractArchive(p(name), out, safe); err != nil {
+			log.Fatal(err)
+		}
+		fileInfo, _ := os.Stat(filepath.Join(out, "bin/run.sh"))
+		link, _ := os.Readlink(filepath.Join(out, "link.txt"))
+		fmt.Printf("%-14s run.sh: %v, link.txt -> %s\n", name, fileInfo.Mode(), link)
+	}
+	// => backup.tar     run.sh: -rwxr-xr-x, link.txt -> a.txt
+	// => backup.tar.gz  run.sh: -rwxr-xr-x, link.txt -> a.txt
+	// => backup.zip     run.sh: -rwxr-xr-x, link.txt -> a.txt
+
+	// MALICIOUS ARCHIVES
+	now := time.Now()
+	tests := map[string][]*tar.Header{
+		"zip-slip.tar": {{Name: "../../evil.txt", Typeflag: tar.TypeReg, Mode: 0644, ModTime: now}},
+		"absolute.tar": {{Name: "/tmp/evil.txt", Typeflag: tar.TypeReg, Mode: 0644, ModTime: now}},
+		"symlink.tar": {
+			{Name: "etc", Typeflag: tar.TypeSymlink, Linkname: "../../../../etc"},
+		},
+		"through-link.tar": {
+			{Name: "inside", Typeflag: tar.TypeSymlink, Linkname: "."},
+			{Name: "inside/evil.txt", Typeflag: tar.TypeReg, Mode: 0644, ModTime: now},
+		},
+		// each link looks safe lexically, but l2 -> l/.. is the parent of dest because l is dest
+		"link-chain.tar": {
+			{Name: "d/l", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			{Name: "d/l2", Typeflag: tar.TypeSymlink, Linkname: "l/.."},
+		},
+	}
+	for _, name := range []string{"zip-slip.tar", "absolute.tar", "symlink.tar", "through-link.tar", "link-chain.tar"} {
+		maliciousTar(p(name), tests[name], "evil")
+		err := extractArchive(p(name), p("out-"+name), safe)
+		fmt.Printf("%-17s %v\n", name, err)
+	}
+	// => zip-slip.tar      "../../evil.txt": unsafe path (escapes destination)
+	// => absolute.tar      "/tmp/evil.txt": unsafe path (absolute)
+	// => symlink.tar       symlink .../etc -> ../../../../etc: unsafe path (escapes destination)
+	// => through-link.tar  "inside/evil.txt": unsafe path (through symlink .../inside)
+	// => link-chain.tar    symlink .../d/l2 -> l/..: unsafe path (escapes destination)
+
+	// A DECOMPRESSION BOMB: 10 MB of zeros compress to about 20 KB
+	bomb, _ := os.Create(p("bomb.tar.gz"))
+	zw := gzip.NewWriter(bomb)
+	tw := tar.NewWriter(zw)
+	tw.WriteHeader(&tar.Header{Name: "zeros", Typeflag: tar.TypeReg, Mode: 0644, Size: 10 << 20, ModTime: now})
+	io.Copy(tw, io.LimitReader(zeroReader{}, 10<<20))
+	tw.Close()
+	zw.Close()
+	bomb.Close()
+
+	bombInfo, _ := os.Stat(p("bomb.tar.gz"))
+	err = extractArchive(p("bomb.tar.gz"), p("out-bomb"), safe)
+	fmt.Printf("bomb.tar.gz (%d bytes) %v\n", bombInfo.Size(), err)
+	// => bomb.tar.gz (20627 bytes) archive exceeds limit: .../out-bomb/zeros is too large (decompression bomb?)
+}
+
+// zeroReader is an io.Reader that returns zeros forever
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func main() {
+	log.SetFlags(0)
+	usage := "usage: archives.go create <archive> <dir> | extract <archive> <dir> [options] | demo"
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	switch os.Args[1] {
+	case "create":
+		if len(os.Args) != 4 {
+			log.Fatal(usage)
+		}
+		if err := createArchive(os.Args[2], os.Args[3]); err != nil {
+			log.Fatal(err)
+		}
+	case "extract":
+		if len(os.Args) < 4 {
+			log.Fatal(usage)
+		}
+		cmd := flag.NewFlagSet("extract", flag.ExitOnError)
+		maxSize := cmd.Int64("max-size", 1<<30, "max. total size of the extracted files in bytes")
+		maxFile := cmd.Int64("max-file-size", 1<<30, "max. size of one extracted file in bytes")
+		maxEntries := cmd.Int("max-entries", 10000, "max. number of entries")
+		cmd.Parse(os.Args[4:])
+		l := limits{maxTotalSize: *maxSize, maxFileSize: *maxFile, maxEntries: *maxEntries}
+		if err := extractArchive(os.Args[2], os.Args[3], l); err != nil {
+			log.Fatal(err)
+		}
+	case "demo":
+		demo()
+	default:
+		log.Fatal(usage)
+	}
+}
@@ -0,0 +1,130 @@
+/////////////////////////////////
+// Tests: Extracting Malicious Archives
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Execute: go test -v archives.go archives_test.go
+
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExtractSymlinks(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		entries []*tar.Header
+		unsafe  bool
+	}{
+		{"link outside", []*tar.Header{
+			{Name: "etc", Typeflag: tar.TypeSymlink, Linkname: "../../../../etc"},
+		}, true},
+		{"chain of links: l2 -> l/.. where l -> ..", []*tar.Header{
+			{Name: "d/l", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			{Name: "d/l2", Typeflag: tar.TypeSymlink, Linkname: "l/.."},
+		}, true},
+		{"chain through a link to a directory", []*tar.Header{
+			{Name: "a/b/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "up", Typeflag: tar.TypeSymlink, Linkname: "a/b"},
+			{Name: "a/l", Typeflag: tar.TypeSymlink, Linkname: "../up/../../.."},
+		}, true},
+		{".. after a directory that doesn't exist yet", []*tar.Header{
+			{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "later/.."},
+			{Name: "later", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		}, true},
+		{"file written through a link", []*tar.Header{
+			{Name: "inside", Typeflag: tar.TypeSymlink, Linkname: "."},
+			{Name: "inside/evil.txt", Typeflag: tar.TypeReg, Mode: 0644, ModTime: now},
+		}, true},
+		{"chain of links that stays inside", []*tar.Header{
+			{Name: "d/e/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "d/l", Typeflag: tar.TypeSymlink, Linkname: "e"},
+			{Name: "d/l2", Typeflag: tar.TypeSymlink, Linkname: "l/.."},
+		}, false},
+		{"link to a file extracted later", []*tar.Header{
+			{Name: "current", Typeflag: tar.TypeSymlink, Linkname: "releases/v2/run.sh"},
+			{Name: "releases/v2/run.sh", Typeflag: tar.TypeReg, Mode: 0755, ModTime: now},
+		}, false},
+	}
+
+	dir := t.TempDir()
+	safe := limits{maxTotalSize: 1 << 20, maxFileSize: 1 << 20, maxEntries: 100}
+	for i, tt := range tests {
+		archive := filepath.Join(dir, "test.tar")
+		maliciousTar(archive, tt.entries, "content")
+		dest := filepath.Join(dir, fmt.Sprint("out", i))
+		err := extractArchive(archive, dest, safe)
+		if got := errors.Is(err, errUnsafePath); got != tt.unsafe {
+			t.Errorf("%s: extractArchive() = %v, want unsafe: %v", tt.name, err, tt.unsafe)
+		}
+		// the unsafe entry is the last one: it must not have been created
+		last := tt.entries[len(tt.entries)-1].Name
+		if _, err := os.Lstat(filepath.Join(dest, last)); tt.unsafe && err == nil {
+			t.Errorf("%s: %s was extracted", tt.name, last)
+		}
+	}
+}
+
+// a helper function that writes a tar archive with files of the given sizes, named f0, f1, ...
+func sizedTar(t *testing.T, path string, sizes ...int64) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	tw := tar.NewWriter(file)
+	for i, size := range sizes {
+		hdr := &tar.Header{Name: fmt.Sprint("f", i), Typeflag: tar.TypeReg, Mode: 0644, Size: size}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(make([]byte, size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractLimits(t *testing.T) {
+	const mib = 1 << 20
+	tests := []struct {
+		name    string
+		limits  limits
+		sizes   []int64
+		tooBig  bool
+		created int // the number of files left in the destination
+	}{
+		{"total reached, then a file under the file limit", limits{maxTotalSize: 100, maxFileSize: mib}, []int64{100, 5 * mib}, true, 1},
+		{"total reached, no file limit", limits{maxTotalSize: 100}, []int64{100, 5 * mib}, true, 1},
+		{"total exceeded in the second file", limits{maxTotalSize: 150, maxFileSize: mib}, []int64{100, 5 * mib}, true, 1},
+		{"file limit only", limits{maxFileSize: mib}, []int64{100, 5 * mib}, true, 1},
+		{"within the limits", limits{maxTotalSize: 200, maxFileSize: 100}, []int64{100, 100}, false, 2},
+		{"no limits", limits{}, []int64{100, 5 * mib}, false, 2},
+	}
+
+	dir := t.TempDir()
+	for i, tt := range tests {
+		archive := filepath.Join(dir, "sized.tar")
+		sizedTar(t, archive, tt.sizes...)
+		dest := filepath.Join(dir, fmt.Sprint("out", i))
+		err := extractArchive(archive, dest, tt.limits)
+		if got := errors.Is(err, errLimit); got != tt.tooBig {
+			t.Errorf("%s: extractArchive() = %v, want errLimit: %v", tt.name, err, tt.tooBig)
+		}
+		entries, _ := os.ReadDir(dest)
+		if len(entries) != tt.created {
+			t.Errorf("%s: %d files extracted, want %d", tt.name, len(entries), tt.created)
+		}
+	}
+}
@@ -0,0 +1,445 @@
+/////////////////////////////////
+// Big Factorials and Combinatorics (math/big, Parallel Binary Splitting)
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+
+// Execute:
+// go run big-factorial.go factorial 1000            all the digits of 1000!
+// go run big-factorial.go binomial 100 50           C(100, 50)
+// go run big-factorial.go permutations 100 3        P(100, 3)
+// go run big-factorial.go serve -addr :8080         curl "localhost:8080/factorial?n=1000"
+// The benchmarks compare the algorithms up to 100000!:
+// go test -bench . -benchmem big-factorial.go big-factorial_test.go
+
+// factorial(n int, c chan int) in channels.go overflows for n > 20: 21! doesn't fit in 64 bits.
+// math/big.Int grows as needed: 100000! has 456574 digits.
+// Multiplying 1*2*3*...*n one by one is slow because every step multiplies a HUGE number by a small one.
+// Binary splitting multiplies numbers of similar size, where math/big uses the fast Karatsuba algorithm:
+//	product(1, 8) = product(1, 4) * product(5, 8) = (product(1, 2) * product(3, 4)) * (product(5, 6) * product(7, 8))
+// The two halves are independent, so they can be computed by different goroutines.
+
+package main
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/////////////////////////////////
+// Products, Factorials, Binomials
+/////////////////////////////////
+
+// below this many factors a range is multiplied in a single loop
+const leafSize = 32
+
+// declaring a function that returns lo * (lo+1) * ... * hi, splitting the range in two halves.
+// The top depth levels of the tree run the two halves in different goroutines.
+func product(lo, hi int64, depth int) *big.Int {
+	if lo > hi {
+		return big.NewInt(1)
+	}
+	if hi-lo < leafSize {
+		p := big.NewInt(lo)
+		var factor big.Int
+		for i := lo + 1; i <= hi; i++ {
+			p.Mul(p, factor.SetInt64(i))
+		}
+		return p
+	}
+	mid := lo + (hi-lo)/2
+	var left, right *big.Int
+	if depth > 0 {
+		done := make(chan struct{})
+		go func() {
+			left = product(lo, mid, depth-1)
+			close(done)
+		}()
+		right = product(mid+1, hi, depth-1)
+		<-done
+	} else {
+		left = product(lo, mid, 0)
+		right = product(mid+1, hi, 0)
+	}
+	return left.Mul(left, right)
+}
+
+// the depth of the tree that runs in parallel: 2^depth goroutines at the bottom, a few per CPU
+func parallelDepth() int {
+	depth := 0
+	for 1<<depth < 4*runtime.NumCPU() {
+		depth++
+	}
+	return depth
+}
+
+var errNegative = errors.New("arguments must be non-negative")
+
+// declaring a function that returns n!
+func factorial(n int64) (*big.Int, error) {
+	if n < 0 {
+		return nil, errNegative
+	}
+	return product(2, n, parallelDepth()), nil
+}
+
+// declaring a function that returns P(n, k) = n! / (n-k)!, the number of ordered selections of k out of n
+func permutations(n, k int64) (*big.Int, error) {
+	if n < 0 || k < 0 {
+		return nil, errNegative
+	}
+	if k > n {
+		return big.NewInt(0), nil
+	}
+	return product(n-k+1, n, parallelDepth()), nil
+}
+
+// declaring a function that returns C(n, k) = n! / (k! * (n-k)!), the number of subsets of k out of n
+func binomial(n, k int64) (*big.Int, error) {
+	if n < 0 || k < 0 {
+		return nil, errNegative
+	}
+	if k > n {
+		return big.NewInt(0), nil
+	}
+	k = min(k, n-k) // C(100, 98) = C(100, 2): fewer factors
+	p, _ := permutations(n, k)
+	f, _ := factorial(k)
+	return p.Quo(p, f), nil
+}
+
+/////////////////////////////////
+// LRU Cache
+/////////////////////////////////
+
+// declaring a generic struct type for a Least Recently Used cache:
+// when it's full, the entry that was not used for the longest time is removed.
+// The list keeps the entries from the most to the least recently used, the map finds them in O(1).
+type lru[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[K]*list.Element
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+func newLRU[K comparable, V any](capacity int) *lru[K, V] {
+	return &lru[K, V]{capacity: capacity, order: list.New(), items: make(map[K]*list.Element)}
+}
+
+func (c *lru[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*lruEntry[K, V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+func (c *lru[K, V]) Put(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		e.Value.(*lruEntry[K, V]).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry[K, V]{key, value})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry[K, V]).key)
+	}
+}
+
+// the key of a cached result: the operation and its arguments
+type calcKey struct {
+	op   string
+	n, k int64
+}
+
+var cache = newLRU[calcKey, *big.Int](32)
+
+// declaring a function that computes an operation or returns it from the cache.
+// The cached *big.Int is shared: callers must not modify it.
+func compute(op string, n, k int64) (*big.Int, error) {
+	key := calcKey{op, n, k}
+	if v, ok := cache.Get(key); ok {
+		return v, nil
+	}
+	var v *big.Int
+	var err error
+	switch op {
+	case "factorial":
+		v, err = factorial(n)
+	case "binomial":
+		v, err = binomial(n, k)
+	case "permutations":
+		v, err = permutations(n, k)
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cache.Put(key, v)
+	return v, nil
+}
+
+/////////////////////////////////
+// Streaming the Digits
+/////////////////////////////////
+
+// the number of digits converted at once by big.Int.Text()
+const digitsChunk = 64 * 1024
+
+// powers of ten: tens[i] = 10^(digitsChunk * 2^i), computed once and shared
+var (
+	tensMu sync.Mutex
+	tens   []*big.Int
+)
+
+func pow10(i int) *big.Int {
+	tensMu.Lock()
+	defer tensMu.Unlock()
+	for len(tens) <= i {
+		if len(tens) == 0 {
+			tens = append(tens, new(big.Int).Exp(big.NewInt(10), big.NewInt(digitsChunk), nil))
+			continue
+		}
+		last := tens[len(tens)-1]
+		tens = append(tens, new(big.Int).Mul(last, last))
+	}
+	return tens[i]
+}
+
+// declaring a function that writes the decimal digits in chunks, flushing after each one,
+// so a client sees the first digits before the last ones are computed.
+// v.Text(10) would build the 5.5 million digits of 1000000! before writing anything: here v is split
+// by a power of ten into its high and low digits, again and again, and only the chunks are converted.
+func writeDigits(w io.Writer, v *big.Int, flush func()) error {
+	level := 0
+	for v.Cmp(pow10(level)) >= 0 {
+		level++
+	}
+	if err := writeDigitsLevel(w, v, level, false, flush); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// declaring a function that writes v < 10^(digitsChunk * 2^level), with the leading zeros if padded
+// (the low half of a number keeps its zeros: 1000 split by 100 is 10 and 00).
+func writeDigitsLevel(w io.Writer, v *big.Int, level int, padded bool, flush func()) error {
+	if level == 0 {
+		digits := v.Text(10)
+		if padded {
+			if _, err := io.WriteString(w, strings.Repeat("0", digitsChunk-len(digits))); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, digits); err != nil {
+			return err
+		}
+		if flush != nil {
+			flush()
+		}
+		return nil
+	}
+	high, low := new(big.Int).QuoRem(v, pow10(level-1), new(big.Int))
+	if !padded && high.Sign() == 0 {
+		return writeDigitsLevel(w, low, level-1, false, flush)
+	}
+	if err := writeDigitsLevel(w, high, level-1, padded, flush); err != nil {
+		return err
+	}
+	return writeDigitsLevel(w, low, level-1, true, flush)
+}
+
+/////////////////////////////////
+// The Server
+/////////////////////////////////
+
+// the largest n accepted by the server: 1000000! takes seconds and has 5.5 million digits
+const maxN = 1000000
+
+// Every computation already uses all the CPUs (parallelDepth), so only a few run at the same time;
+// the same request sent many times in parallel is computed once (like golang.org/x/sync/singleflight),
+// and too many different requests waiting are refused instead of queued forever.
+const (
+	maxComputations = 2
+	maxWaiting      = 32
+)
+
+var errBusy = errors.New("server busy, try again later")
+
+// declaring a struct type for a computation in progress, shared by the requests that wait for it
+type flight struct {
+	done chan struct{} // closed when v and err are set
+	v    *big.Int
+	err  error
+}
+
+var (
+	cpuSlots  = make(chan struct{}, maxComputations) // a semaphore: a computation sends to take a slot
+	flightsMu sync.Mutex
+	flights   = make(map[calcKey]*flight)
+)
+
+// declaring a function that returns the result of an operation, waiting for the computation already
+// in progress if there's one. The computation goes on if ctx is cancelled: other requests may wait for it.
+func computeShared(ctx context.Context, op string, n, k int64) (*big.Int, error) {
+	key := calcKey{op, n, k}
+	if v, ok := cache.Get(key); ok {
+		return v, nil
+	}
+
+	flightsMu.Lock()
+	f, ok := flights[key]
+	if !ok {
+		if len(flights) >= maxWaiting {
+			flightsMu.Unlock()
+			return nil, errBusy
+		}
+		f = &flight{done: make(chan struct{})}
+		flights[key] = f
+		go func() {
+			cpuSlots <- struct{}{}
+			f.v, f.err = compute(op, n, k)
+			<-cpuSlots
+			flightsMu.Lock()
+			delete(flights, key)
+			flightsMu.Unlock()
+			close(f.done)
+		}()
+	}
+	flightsMu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.v, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// declaring a function that handles /factorial?n=, /binomial?n=&k= and /permutations?n=&k=
+func handler(op string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n, errN := strconv.ParseInt(r.URL.Query().Get("n"), 10, 64)
+		var k int64
+		var errK error
+		if op != "factorial" {
+			k, errK = strconv.ParseInt(r.URL.Query().Get("k"), 10, 64)
+		}
+		if errN != nil || errK != nil || n < 0 || k < 0 || n > maxN {
+			http.Error(w, fmt.Sprintf("invalid arguments: n and k must be between 0 and %d", maxN), http.StatusBadRequest)
+			return
+		}
+		v, err := computeShared(r.Context(), op, n, k)
+		switch {
+		case errors.Is(err, errBusy):
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// converting to decimal costs about as much as computing: it takes a slot too
+		select {
+		case cpuSlots <- struct{}{}:
+			defer func() { <-cpuSlots }()
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		flusher, _ := w.(http.Flusher)
+		writeDigits(w, v, func() {
+			if flusher != nil {
+				flusher.Flush() // sends the chunk now, with chunked transfer encoding
+			}
+		})
+	}
+}
+
+// declaring a function that multiplies 1*2*...*n one by one (big-factorial_test.go compares it with product())
+func naiveFactorial(n int64) *big.Int {
+	f := big.NewInt(1)
+	var factor big.Int
+	for i := int64(2); i <= n; i++ {
+		f.Mul(f, factor.SetInt64(i))
+	}
+	return f
+}
+
+func main() {
+	log.SetFlags(0)
+	usage := "usage: big-factorial.go factorial <n> | binomial <n> <k> | permutations <n> <k> | serve [-addr :8080]"
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	switch op := os.Args[1]; op {
+	case "factorial", "binomial", "permutations":
+		want := 2
+		if op != "factorial" {
+			want = 3
+		}
+		if len(os.Args) != want+1 {
+			log.Fatal(usage)
+		}
+		var args [2]int64
+		for i, s := range os.Args[2:] {
+			v, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				log.Fatal(err)
+			}
+			args[i] = v
+		}
+		v, err := compute(op, args[0], args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := writeDigits(os.Stdout, v, nil); err != nil {
+			log.Fatal(err)
+		}
+		// go run big-factorial.go factorial 25     => 15511210043330985984000000
+		// go run big-factorial.go binomial 100 50  => 100891344545564193334812497256
+		// go run big-factorial.go permutations 10 3 => 720
+
+	case "serve":
+		cmd := flag.NewFlagSet("serve", flag.ExitOnError)
+		addr := cmd.String("addr", ":8080", "address to listen on")
+		cmd.Parse(os.Args[2:])
+		for _, op := range []string{"factorial", "binomial", "permutations"} {
+			http.HandleFunc("/"+op, handler(op))
+		}
+		log.Println("listening on", *addr)
+		log.Fatal(http.ListenAndServe(*addr, nil))
+		// curl "localhost:8080/binomial?n=100&k=50" => 100891344545564193334812497256
+
+	default:
+		log.Fatal(usage)
+	}
+}
@@ -0,0 +1,156 @@
+/////////////////////////////////
+// Tests and Benchmarks: Big Factorials
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Execute: go test -v big-factorial.go big-factorial_test.go
+// Execute: go test -run XXX -bench . -benchmem big-factorial.go big-factorial_test.go
+
+// factorial(n int, c chan int) in channels.go overflows: 21! with int is -4249290049419214848.
+// => BenchmarkFactorial/1000/naive             15753       76798 ns/op
+// => BenchmarkFactorial/1000/splitting         29821       42753 ns/op
+// => BenchmarkFactorial/100000/naive               1  1357251970 ns/op   466351648 B/op
+// => BenchmarkFactorial/100000/splitting          15    71365795 ns/op     3401225 B/op
+// => BenchmarkFactorial/100000/parallel           21    49924444 ns/op     3574640 B/op
+// => BenchmarkFactorial/100000/decimal            16    63878952 ns/op     5310412 B/op   (456574 digits)
+// (with N CPUs the parallel tree is close to N times faster than splitting)
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		op   string
+		n, k int64
+		want string
+	}{
+		{"factorial", 0, 0, "1"},
+		{"factorial", 21, 0, "51090942171709440000"},
+		{"factorial", 25, 0, "15511210043330985984000000"},
+		{"binomial", 100, 50, "100891344545564193334812497256"},
+		{"binomial", 3, 5, "0"},
+		{"permutations", 10, 3, "720"},
+	}
+	for _, tt := range tests {
+		v, err := compute(tt.op, tt.n, tt.k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.String() != tt.want {
+			t.Errorf("%s(%d, %d) = %s, want %s", tt.op, tt.n, tt.k, v, tt.want)
+		}
+	}
+	if _, err := compute("factorial", -1, 0); !errors.Is(err, errNegative) {
+		t.Errorf("factorial(-1): got %v, want %v", err, errNegative)
+	}
+}
+
+func TestWriteDigits(t *testing.T) {
+	ten := big.NewInt(10)
+	pow := func(e int64) *big.Int { return new(big.Int).Exp(ten, big.NewInt(e), nil) }
+	one := big.NewInt(1)
+	f, _ := factorial(100000)
+
+	tests := map[string]*big.Int{
+		"0":                 big.NewInt(0),
+		"10^chunk - 1":      new(big.Int).Sub(pow(digitsChunk), one),
+		"10^chunk":          pow(digitsChunk), // the low half is all zeros
+		"10^(2*chunk) + 1":  new(big.Int).Add(pow(2*digitsChunk), one),
+		"10^(5*chunk) + 42": new(big.Int).Add(pow(5*digitsChunk), big.NewInt(42)),
+		"100000!":           f,
+	}
+	for name, v := range tests {
+		var buf bytes.Buffer
+		flushes := 0
+		if err := writeDigits(&buf, v, func() { flushes++ }); err != nil {
+			t.Fatal(err)
+		}
+		if want := v.Text(10) + "\n"; buf.String() != want {
+			t.Errorf("%s: the digits are different (%d digits, want %d)", name, buf.Len()-1, len(want)-1)
+		}
+		if wantFlushes := (len(v.Text(10)) + digitsChunk - 1) / digitsChunk; flushes != wantFlushes {
+			t.Errorf("%s: %d flushes, want %d", name, flushes, wantFlushes)
+		}
+	}
+}
+
+func TestComputeShared(t *testing.T) {
+	// the same request in parallel: every caller gets the result of a single computation
+	const callers = 20
+	results := make([]*big.Int, callers)
+	var wg sync.WaitGroup
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := computeShared(context.Background(), "factorial", 30000, 0)
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = v
+		}()
+	}
+	wg.Wait()
+	for i, v := range results {
+		if v != results[0] {
+			t.Fatalf("caller %d got another *big.Int: the factorial was computed twice", i)
+		}
+	}
+
+	// too many different requests waiting: refused
+	flightsMu.Lock()
+	for i := range maxWaiting {
+		flights[calcKey{"test", int64(i), 0}] = &flight{done: make(chan struct{})}
+	}
+	flightsMu.Unlock()
+	defer func() {
+		flightsMu.Lock()
+		for i := range maxWaiting {
+			delete(flights, calcKey{"test", int64(i), 0})
+		}
+		flightsMu.Unlock()
+	}()
+	if _, err := computeShared(context.Background(), "factorial", 1234, 0); !errors.Is(err, errBusy) {
+		t.Errorf("got %v, want %v", err, errBusy)
+	}
+}
+
+func BenchmarkFactorial(b *testing.B) {
+	for _, n := range []int64{1000, 10000, 50000, 100000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.Run("naive", func(b *testing.B) {
+				for b.Loop() {
+					naiveFactorial(n)
+				}
+			})
+			b.Run("splitting", func(b *testing.B) {
+				for b.Loop() {
+					product(2, n, 0)
+				}
+			})
+			b.Run("parallel", func(b *testing.B) {
+				for b.Loop() {
+					product(2, n, parallelDepth())
+				}
+			})
+			f := product(2, n, parallelDepth())
+			b.Run("decimal", func(b *testing.B) {
+				var sb strings.Builder
+				for b.Loop() {
+					sb.Reset()
+					writeDigits(&sb, f, nil)
+				}
+			})
+		})
+	}
+}
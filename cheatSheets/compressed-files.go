@@ -0,0 +1,269 @@
+/////////////////////////////////
+// Reading and Writing Compressed Files Transparently (gzip, bzip2, zlib, lzw)
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+// Execute: go run compressed-files.go
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/lzw"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// declaring a defined type for the compression format (codec)
+type codec int
+
+const (
+	plain codec = iota
+	gzipCodec
+	bzip2Codec // compress/bzip2 can only decompress
+	zlibCodec
+	lzwCodec
+)
+
+var (
+	// the error returned when writing a format that can only be read
+	errReadOnly = errors.New("codec can only be read")
+	// the error returned when reading a Unix `compress` (.Z) file
+	errUnixCompress = errors.New("unix compress (.Z) format is not supported, decompress it with `uncompress` or `gzip -d`")
+)
+
+// declaring a function that picks the codec by file extension
+func codecByExtension(path string) codec {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz", ".gzip":
+		return gzipCodec
+	case ".bz2":
+		return bzip2Codec
+	case ".zlib", ".zz":
+		return zlibCodec
+	case ".lzw":
+		// not .Z: the files of the Unix `compress` command start with a 1f 9d header and change the
+		// code width from 9 to 16 bits as the dictionary grows, compress/lzw reads only fixed-width raw streams.
+		return lzwCodec
+	}
+	return plain
+}
+
+// declaring a function that recognizes the codec by the first bytes of the file (the magic bytes)
+func codecByMagic(header []byte) codec {
+	switch {
+	case len(header) >= 2 && header[0] == 0x1f && header[1] == 0x8b:
+		return gzipCodec
+	case len(header) >= 3 && string(header[:3]) == "BZh":
+		return bzip2Codec
+	}
+	// the zlib header is only 2 bytes and many text files start with a valid one ("x^" for example),
+	// so zlib streams are recognized by extension, like LZW streams.
+	return plain
+}
+
+// declaring a struct type that closes the decompressor and then the file
+// (closing a gzip.Reader doesn't close the file it reads from)
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (rc *readCloser) Close() error {
+	var err error
+	for _, c := range rc.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// declaring a function that opens a file for reading and decompresses it if needed.
+// the magic bytes win over the extension, so a .txt file that is really gzip is still read correctly.
+func openFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// bufio.Reader.Peek() looks at the first bytes without consuming them
+	bufferedReader := bufio.NewReader(file)
+	header, _ := bufferedReader.Peek(4)
+
+	if len(header) >= 2 && header[0] == 0x1f && header[1] == 0x9d {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, errUnixCompress)
+	}
+	c := codecByMagic(header)
+	if c == plain {
+		c = codecByExtension(path)
+	}
+
+	var r io.Reader
+	var closers []io.Closer
+	switch c {
+	case gzipCodec:
+		zr, err := gzip.NewReader(bufferedReader)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		r, closers = zr, []io.Closer{zr}
+	case bzip2Codec:
+		r = bzip2.NewReader(bufferedReader)
+	case zlibCodec:
+		zr, err := zlib.NewReader(bufferedReader)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		r, closers = zr, []io.Closer{zr}
+	case lzwCodec:
+		zr := lzw.NewReader(bufferedReader, lzw.LSB, 8)
+		r, closers = zr, []io.Closer{zr}
+	default:
+		r = bufferedReader
+	}
+	return &readCloser{Reader: r, closers: append(closers, file)}, nil
+}
+
+// declaring a struct type that closes the compressor (flushing its data) and then the file
+type writeCloser struct {
+	io.Writer
+	closers []io.Closer
+}
+
+func (wc *writeCloser) Close() error {
+	var err error
+	for _, c := range wc.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// declaring a function that creates (or truncates) a file and compresses what's written to it
+// the codec is picked by extension; Close() must be called, otherwise the file is incomplete.
+func createFile(path string) (io.WriteCloser, error) {
+	c := codecByExtension(path)
+	if c == bzip2Codec {
+		return nil, fmt.Errorf("%s: %w", path, errReadOnly)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var zw io.WriteCloser
+	switch c {
+	case gzipCodec:
+		gw := gzip.NewWriter(file)
+		gw.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		zw = gw
+	case zlibCodec:
+		zw = zlib.NewWriter(file)
+	case lzwCodec:
+		zw = lzw.NewWriter(file, lzw.LSB, 8)
+	default:
+		return file, nil
+	}
+	return &writeCloser{Writer: zw, closers: []io.Closer{zw, file}}, nil
+}
+
+func main() {
+	dir, err := os.MkdirTemp("", "compressed")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"my_file.txt", "my_file.txt.gz", "my_file.txt.zlib", "my_file.txt.lzw", "my_file.txt.bz2"} {
+		path := filepath.Join(dir, name)
+
+		// WRITING USING A BUFFER IN MEMORY (the same code as for a plain file)
+		file, err := createFile(path)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		bufferedWriter := bufio.NewWriter(file)
+		for i := 1; i <= 1000; i++ {
+			bufferedWriter.WriteString("Just a random string that compresses well\n")
+		}
+		if err := bufferedWriter.Flush(); err != nil {
+			log.Fatal(err)
+		}
+		if err := file.Close(); err != nil {
+			log.Fatal(err)
+		}
+
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// READING LINE BY LINE USING bufio.Scanner (the same code as for a plain file)
+		rc, err := openFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		scanner := bufio.NewScanner(rc)
+		lines := 0
+		for scanner.Scan() {
+			lines++
+		}
+		if err := scanner.Err(); err != nil {
+			log.Fatal(err)
+		}
+		rc.Close()
+
+		fmt.Printf("%-18s size: %5d bytes, lines: %d\n", name, fileInfo.Size(), lines)
+	}
+	// => my_file.txt        size: 42000 bytes, lines: 1000
+	// => my_file.txt.gz     size:   210 bytes, lines: 1000
+	// => my_file.txt.zlib   size:   186 bytes, lines: 1000
+	// => my_file.txt.lzw    size:  2432 bytes, lines: 1000
+	// => .../my_file.txt.bz2: codec can only be read
+
+	// DETECTING THE CODEC BY MAGIC BYTES
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("gzip data in a file with the wrong extension\n"))
+	zw.Close()
+	path := filepath.Join(dir, "not-really.txt")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	rc, err := openFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s", data) // => gzip data in a file with the wrong extension
+
+	// A UNIX compress FILE (the output of `compress my_file.txt`) is recognized and refused, not decoded to garbage
+	path = filepath.Join(dir, "my_file.txt.Z")
+	if err := os.WriteFile(path, []byte{0x1f, 0x9d, 0x90, 0x4a, 0x75}, 0644); err != nil {
+		log.Fatal(err)
+	}
+	_, err = openFile(path)
+	fmt.Println(errors.Is(err, errUnixCompress)) // => true
+}
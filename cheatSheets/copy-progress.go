@@ -0,0 +1,391 @@
+/////////////////////////////////
+// Copying Large Files: Progress Bar, Bandwidth Limit and Resume
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+
+// Execute:
+// go run copy-progress.go copy [-resume] [-limit 10M] <src> <dst>
+// go run copy-progress.go demo
+// go test -v copy-progress.go copy-progress_test.go
+// Press Ctrl+C during a copy and run it again with -resume to continue where it stopped.
+
+// io.Copy() is a black box: it returns only when everything is copied.
+// Wrapping the reader gives us hooks for every chunk of data:
+// - a counter for the progress bar
+// - a throttle that sleeps to respect the bandwidth limit
+// - a check of the context that stops the copy when it's cancelled
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/////////////////////////////////
+// Reader Wrappers
+/////////////////////////////////
+
+// declaring a struct type that counts the bytes read; the counter is atomic, the progress bar reads it from another goroutine
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// declaring a struct type that stops reading when the context is cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// declaring a struct type that limits the reading speed to limit bytes per second.
+// After every read it sleeps until the average speed since the start is below the limit.
+type throttledReader struct {
+	ctx   context.Context
+	r     io.Reader
+	limit int64
+	start time.Time
+	n     int64
+}
+
+func newThrottledReader(ctx context.Context, r io.Reader, limit int64) *throttledReader {
+	return &throttledReader{ctx: ctx, r: r, limit: limit, start: time.Now()}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	// small reads (1/10 of a second of data) make the speed smooth
+	if chunk := max(t.limit/10, 1); int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+	n, err := t.r.Read(p)
+	t.n += int64(n)
+
+	expected := time.Duration(float64(t.n) / float64(t.limit) * float64(time.Second))
+	if wait := expected - time.Since(t.start); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-t.ctx.Done():
+			return n, t.ctx.Err()
+		}
+	}
+	return n, err
+}
+
+/////////////////////////////////
+// Progress Bar
+/////////////////////////////////
+
+// a helper function that formats a size like ls -h
+func humanSize(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// declaring a function that returns a line like:
+// [=========>          ]  48%  3.8 MiB / 8.0 MiB  2.0 MiB/s  ETA 2s
+// done counts the bytes copied by this run, offset the bytes already copied by a previous run
+func progressLine(offset, done, total int64, elapsed time.Duration) string {
+	const width = 20
+	current := offset + done
+	percent := 100
+	if total > 0 {
+		percent = int(current * 100 / total)
+	}
+	filled := percent * width / 100
+	bar := strings.Repeat("=", filled)
+	if filled < width {
+		bar += ">" + strings.Repeat(" ", width-filled-1)
+	}
+
+	// the speed of this run, the resumed bytes were not copied now
+	rate := float64(done) / elapsed.Seconds()
+	eta := "--"
+	if rate > 0 {
+		eta = time.Duration(float64(total-current) / rate * float64(time.Second)).Round(time.Second).String()
+	}
+	return fmt.Sprintf("[%s] %3d%%  %s / %s  %s/s  ETA %s", bar, percent, humanSize(current), humanSize(total), humanSize(int64(rate)), eta)
+}
+
+// declaring a function that redraws the progress line every interval until stop is closed.
+// \r moves the cursor to the start of the line, so the new line overwrites the old one.
+func showProgress(w io.Writer, counter *countingReader, offset, total int64, interval time.Duration, stop <-chan struct{}) {
+	start := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fmt.Fprintf(w, "\r%s\033[K", progressLine(offset, counter.n.Load(), total, time.Since(start)))
+		case <-stop:
+			fmt.Fprintf(w, "\r%s\033[K\n", progressLine(offset, counter.n.Load(), total, time.Since(start)))
+			return
+		}
+	}
+}
+
+/////////////////////////////////
+// The Copy Engine
+/////////////////////////////////
+
+// declaring a struct type for the options of a copy
+type copyOptions struct {
+	resume   bool      // continue a partial copy if its bytes match the source
+	limit    int64     // bytes per second, 0 means no limit
+	progress io.Writer // where the progress bar is drawn, nil means no progress bar
+	interval time.Duration
+}
+
+// declaring a struct type for the result of a copy
+type copyResult struct {
+	resumedAt int64 // the number of bytes reused from the partial copy
+	copied    int64 // the number of bytes copied by this run
+	restarted bool  // the partial copy didn't match the source and was discarded
+}
+
+var errSameFile = errors.New("are the same file")
+
+// declaring a function that hashes the first n bytes of a file
+func hashPrefix(ctx context.Context, f *os.File, n int64) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, contextReader{ctx, io.NewSectionReader(f, 0, n)}); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// declaring a function that copies src to dst.
+// The partial destination is kept when the copy fails or is cancelled, so it can be resumed later.
+func copyFile(ctx context.Context, src, dst string, opts copyOptions) (copyResult, error) {
+	var res copyResult
+	in, err := os.Open(src)
+	if err != nil {
+		return res, err
+	}
+	defer in.Close()
+	srcInfo, err := in.Stat()
+	if err != nil {
+		return res, err
+	}
+	total := srcInfo.Size()
+
+	out, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE, srcInfo.Mode().Perm())
+	if err != nil {
+		return res, err
+	}
+	defer out.Close()
+	dstInfo, err := out.Stat()
+	if err != nil {
+		return res, err
+	}
+	// like cp, a file is not copied onto itself (also through a hard link or a symlink):
+	// truncating dst would erase src
+	if os.SameFile(srcInfo, dstInfo) {
+		return res, fmt.Errorf("%s and %s %w", src, dst, errSameFile)
+	}
+
+	// RESUMING: the bytes already in dst are reused only if they're equal to the start of src
+	if opts.resume {
+		if n := dstInfo.Size(); n > 0 && n <= total {
+			srcHash, err := hashPrefix(ctx, in, n)
+			if err != nil {
+				return res, err
+			}
+			dstHash, err := hashPrefix(ctx, out, n)
+			if err != nil {
+				return res, err
+			}
+			if bytes.Equal(srcHash, dstHash) {
+				res.resumedAt = n
+			} else {
+				res.restarted = true
+			}
+		} else if n > total {
+			res.restarted = true // dst is longer than src: it's not a partial copy of it
+		}
+	}
+	if err := out.Truncate(res.resumedAt); err != nil {
+		return res, err
+	}
+	if _, err := in.Seek(res.resumedAt, io.SeekStart); err != nil {
+		return res, err
+	}
+	if _, err := out.Seek(res.resumedAt, io.SeekStart); err != nil {
+		return res, err
+	}
+
+	// building the chain of readers: file -> context check -> throttle -> counter
+	var r io.Reader = contextReader{ctx, in}
+	if opts.limit > 0 {
+		r = newThrottledReader(ctx, r, opts.limit)
+	}
+	counter := &countingReader{r: r}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	if opts.progress != nil {
+		interval := opts.interval
+		if interval == 0 {
+			interval = 200 * time.Millisecond
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			showProgress(opts.progress, counter, res.resumedAt, total, interval, stop)
+		}()
+	}
+
+	// *os.File implements io.ReaderFrom, but our wrapped reader hides it, so io.Copy() uses a 32 KB buffer
+	_, err = io.Copy(out, counter)
+	close(stop)
+	wg.Wait()
+	res.copied = counter.n.Load()
+	if err != nil {
+		return res, err
+	}
+	// Sync() writes the data to the disk: a successful copy must survive a power failure
+	if err := out.Sync(); err != nil {
+		return res, err
+	}
+	return res, out.Close()
+}
+
+// a helper function that parses sizes like 512K, 10M or 1G (powers of 1024)
+func parseSize(s string) (int64, error) {
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1 << 30
+	}
+	n, err := strconv.ParseInt(strings.TrimRight(s, "KMG"), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
+
+func demo() {
+	dir, err := os.MkdirTemp("", "copy")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src, dst := filepath.Join(dir, "big.bin"), filepath.Join(dir, "copy.bin")
+
+	data := make([]byte, 8<<20) // 8 MiB of random data
+	rand.Read(data)
+	os.WriteFile(src, data, 0644)
+	opts := copyOptions{limit: 4 << 20, progress: os.Stdout, interval: 500 * time.Millisecond}
+
+	// 1. a copy at 4 MiB/s cancelled after 1 second
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	res, err := copyFile(ctx, src, dst, opts)
+	cancel()
+	fmt.Println("Stopped:", err, "after", humanSize(res.copied))
+	// => [====>               ]  24%  2.0 MiB / 8.0 MiB  3.9 MiB/s  ETA 2s
+	// => [==========>         ]  50%  4.0 MiB / 8.0 MiB  4.0 MiB/s  ETA 1s
+	// => Stopped: context deadline exceeded after 4.0 MiB
+
+	// 2. resuming: only the rest of the file is copied
+	opts.resume = true
+	res, err = copyFile(context.Background(), src, dst, opts)
+	copied, _ := os.ReadFile(dst)
+	fmt.Println("Resumed at", humanSize(res.resumedAt), "copied", humanSize(res.copied), err, bytes.Equal(data, copied))
+	// => [==============>     ]  74%  6.0 MiB / 8.0 MiB  3.9 MiB/s  ETA 1s
+	// => [====================] 100%  8.0 MiB / 8.0 MiB  4.0 MiB/s  ETA 0s
+	// => Resumed at 4.0 MiB copied 4.0 MiB <nil> true
+
+	// 3. a partial copy that doesn't match the source is copied again from the start
+	os.Truncate(dst, 1<<20)
+	f, _ := os.OpenFile(dst, os.O_WRONLY, 0)
+	f.WriteAt([]byte("corrupted"), 1000)
+	f.Close()
+	opts.limit, opts.progress = 0, nil
+	res, err = copyFile(context.Background(), src, dst, opts)
+	copied, _ = os.ReadFile(dst)
+	fmt.Println("Restarted:", res.restarted, "copied", humanSize(res.copied), err, bytes.Equal(data, copied))
+	// => Restarted: true copied 8.0 MiB <nil> true
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		log.Fatal("usage: copy-progress.go copy [-resume] [-limit 10M] <src> <dst> | demo")
+	}
+
+	switch os.Args[1] {
+	case "copy":
+		cmd := flag.NewFlagSet("copy", flag.ExitOnError)
+		resume := cmd.Bool("resume", false, "continue a partial copy")
+		limit := cmd.String("limit", "0", "bandwidth limit in bytes per second (512K, 10M, 1G)")
+		cmd.Parse(os.Args[2:])
+		if cmd.NArg() != 2 {
+			log.Fatal("usage: copy-progress.go copy [-resume] [-limit 10M] <src> <dst>")
+		}
+		bytesPerSecond, err := parseSize(*limit)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Ctrl+C cancels the context: the copy stops cleanly and the partial file stays for -resume
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		res, err := copyFile(ctx, cmd.Arg(0), cmd.Arg(1), copyOptions{resume: *resume, limit: bytesPerSecond, progress: os.Stderr})
+		if res.restarted {
+			fmt.Fprintln(os.Stderr, "the partial copy didn't match the source, copied from the start")
+		}
+		if errors.Is(err, context.Canceled) {
+			log.Fatalf("interrupted after %s, run again with -resume to continue", humanSize(res.resumedAt+res.copied))
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "demo":
+		demo()
+	default:
+		log.Fatalf("unknown command %q", os.Args[1])
+	}
+}
@@ -0,0 +1,148 @@
+/////////////////////////////////
+// Tests: Copying, Resuming and Cancelling
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Execute: go test -v copy-progress.go copy-progress_test.go
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// a helper function that writes a source file of random data and returns its content and the paths
+func sourceFile(t *testing.T, size int) (data []byte, src, dst string) {
+	t.Helper()
+	dir := t.TempDir()
+	src, dst = filepath.Join(dir, "src.bin"), filepath.Join(dir, "dst.bin")
+	data = make([]byte, size)
+	rand.Read(data)
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return data, src, dst
+}
+
+// a helper function that checks that dst is a complete copy
+func checkCopy(t *testing.T, dst string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("the copy has %d bytes and differs from the source (%d bytes)", len(got), len(want))
+	}
+}
+
+func TestCopy(t *testing.T) {
+	data, src, dst := sourceFile(t, 1<<20)
+	res, err := copyFile(context.Background(), src, dst, copyOptions{})
+	if err != nil || res.copied != int64(len(data)) || res.resumedAt != 0 || res.restarted {
+		t.Fatalf("copyFile() = %+v, %v", res, err)
+	}
+	checkCopy(t, dst, data)
+}
+
+func TestCopyResume(t *testing.T) {
+	data, src, dst := sourceFile(t, 1<<20)
+	const partial = 300000
+	tests := []struct {
+		name      string
+		dst       []byte // the content of dst before the copy
+		resumedAt int64
+		restarted bool
+	}{
+		{"matching partial copy", data[:partial], partial, false},
+		{"partial copy that doesn't match", append([]byte("corrupted"), data[9:partial]...), 0, true},
+		{"dst longer than src", append(bytes.Clone(data), "more"...), 0, true},
+		{"complete copy", data, int64(len(data)), false},
+		{"empty dst", nil, 0, false},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(dst, tt.dst, 0644); err != nil {
+			t.Fatal(err)
+		}
+		res, err := copyFile(context.Background(), src, dst, copyOptions{resume: true})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if res.resumedAt != tt.resumedAt || res.restarted != tt.restarted || res.copied != int64(len(data))-tt.resumedAt {
+			t.Errorf("%s: copyFile() = %+v, want resumedAt: %d, restarted: %v", tt.name, res, tt.resumedAt, tt.restarted)
+		}
+		checkCopy(t, dst, data)
+	}
+}
+
+func TestCopyWithoutResumeStartsOver(t *testing.T) {
+	data, src, dst := sourceFile(t, 1<<20)
+	if err := os.WriteFile(dst, data[:1000], 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := copyFile(context.Background(), src, dst, copyOptions{})
+	if err != nil || res.resumedAt != 0 || res.copied != int64(len(data)) {
+		t.Fatalf("copyFile() = %+v, %v; want a full copy", res, err)
+	}
+	checkCopy(t, dst, data)
+}
+
+func TestCopyCancel(t *testing.T) {
+	data, src, dst := sourceFile(t, 4<<20)
+
+	// at 4 MiB/s, the copy is stopped after about 1 MiB
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	res, err := copyFile(ctx, src, dst, copyOptions{limit: 4 << 20})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("copyFile() = %v, want DeadlineExceeded", err)
+	}
+	fileInfo, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileInfo.Size() == 0 || fileInfo.Size() >= int64(len(data)) || fileInfo.Size() != res.copied {
+		t.Fatalf("the partial copy has %d bytes, copied %d of %d", fileInfo.Size(), res.copied, len(data))
+	}
+
+	// the partial copy is kept and resumed
+	res, err = copyFile(context.Background(), src, dst, copyOptions{resume: true})
+	if err != nil || res.resumedAt != fileInfo.Size() || res.restarted {
+		t.Fatalf("resuming: copyFile() = %+v, %v; want resumedAt: %d", res, err, fileInfo.Size())
+	}
+	checkCopy(t, dst, data)
+
+	// an already cancelled context copies nothing
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := copyFile(ctx, src, filepath.Join(t.TempDir(), "none.bin"), copyOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("copyFile() with a cancelled context = %v, want Canceled", err)
+	}
+}
+
+func TestCopySameFile(t *testing.T) {
+	data, src, dst := sourceFile(t, 1000)
+	if err := os.Link(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	symlink := filepath.Join(filepath.Dir(src), "link.bin")
+	if err := os.Symlink(src, symlink); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{src, dst, symlink} {
+		for _, resume := range []bool{false, true} {
+			_, err := copyFile(context.Background(), src, target, copyOptions{resume: resume})
+			if !errors.Is(err, errSameFile) {
+				t.Errorf("copyFile(src, %s, resume: %v) = %v, want errSameFile", filepath.Base(target), resume, err)
+			}
+		}
+	}
+	checkCopy(t, src, data)
+}
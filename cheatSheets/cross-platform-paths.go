@@ -0,0 +1,488 @@
+/////////////////////////////////
+// Cross-Platform Paths (Windows and POSIX Flavors)
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+// Execute: go run cross-platform-paths.go
+
+// path/filepath always uses the rules of the OS the program runs on.
+// On Linux, filepath.Clean(`C:\Users\..\Andrei`) returns the string unchanged: \ is a normal character there.
+// Windows paths found in configs and archives need the Windows rules even on Linux,
+// so here both flavors are explicit values that work the same on every OS.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+/////////////////////////////////
+// Flavors
+/////////////////////////////////
+
+// declaring a struct type that describes the path rules of an OS
+type flavor struct {
+	name      string
+	separator byte
+	windows   bool // \ and / are separators, volumes, case-insensitive names
+}
+
+var (
+	windows = flavor{name: "windows", separator: '\\', windows: true}
+	posix   = flavor{name: "posix", separator: '/'}
+)
+
+func (f flavor) isSep(c byte) bool {
+	return c == '/' || (f.windows && c == '\\')
+}
+
+// a helper function that returns the length of s up to the first separator
+func (f flavor) uptoSep(s string) int {
+	for i := 0; i < len(s); i++ {
+		if f.isSep(s[i]) {
+			return i
+		}
+	}
+	return len(s)
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+/////////////////////////////////
+// Volumes
+/////////////////////////////////
+
+// Windows volumes:
+// C:                      drive letter
+// \\server\share          UNC path (a network share)
+// \\?\C: and \\.\COM1     device paths, \\?\ turns off the normalization done by Windows
+// \\?\UNC\server\share    a UNC path as a device path
+
+// method that returns the length of the volume at the start of p (always 0 on POSIX)
+func (f flavor) volumeLen(p string) int {
+	if !f.windows {
+		return 0
+	}
+	if len(p) >= 2 && p[1] == ':' && isLetter(p[0]) {
+		return 2
+	}
+	if len(p) < 3 || !f.isSep(p[0]) || !f.isSep(p[1]) || f.isSep(p[2]) {
+		return 0 // \\\x is just a rooted path with repeated separators
+	}
+	if len(p) >= 4 && (p[2] == '?' || p[2] == '.') && f.isSep(p[3]) {
+		rest := p[4:]
+		if len(rest) >= 4 && strings.EqualFold(rest[:3], "UNC") && f.isSep(rest[3]) {
+			return 8 + f.uncLen(rest[4:])
+		}
+		return 4 + f.uptoSep(rest)
+	}
+	return 2 + f.uncLen(p[2:])
+}
+
+// method that returns the length of "server\share"
+func (f flavor) uncLen(p string) int {
+	n := f.uptoSep(p)
+	if n == len(p) {
+		return n
+	}
+	return n + 1 + f.uptoSep(p[n+1:])
+}
+
+// method that returns the volume with normalized separators: `C:`, `\\server\share` or ""
+func (f flavor) volumeName(p string) string {
+	return f.toSep(p[:f.volumeLen(p)])
+}
+
+func (f flavor) toSep(p string) string {
+	if f.windows {
+		return strings.ReplaceAll(p, "/", `\`)
+	}
+	return p
+}
+
+// method that reports if the volume is a drive letter (C:) and not a UNC or device path
+func (f flavor) isDrive(vol string) bool {
+	return len(vol) == 2
+}
+
+// method that reports if the volume is a network share: \\server\share or \\?\UNC\server\share
+func (f flavor) isUNC(vol string) bool {
+	if len(vol) < 3 || f.isDrive(vol) {
+		return false
+	}
+	if vol[2] == '?' || vol[2] == '.' {
+		return len(vol) >= 8 && strings.EqualFold(vol[4:8], `UNC\`)
+	}
+	return true
+}
+
+// method that reports if p is absolute
+// On Windows \Users is NOT absolute: it's relative to the current drive. C:Users is relative to the current directory of C:.
+func (f flavor) isAbs(p string) bool {
+	n := f.volumeLen(p)
+	if !f.windows {
+		return strings.HasPrefix(p, "/")
+	}
+	if n == 0 {
+		return false
+	}
+	if !f.isDrive(p[:n]) {
+		return true // UNC and device paths are always absolute
+	}
+	return len(p) > n && f.isSep(p[n])
+}
+
+/////////////////////////////////
+// Clean, Join, Split, Base, Dir
+/////////////////////////////////
+
+// method that returns the shortest equivalent path, with the rules of filepath.Clean():
+// 1. repeated separators become one separator
+// 2. . elements are removed
+// 3. name/.. pairs are removed
+// 4. .. at the root is removed: /.. => /
+// On Windows / is also replaced by \.
+func (f flavor) clean(p string) string {
+	n := f.volumeLen(p)
+	vol, rest := f.toSep(p[:n]), p[n:]
+	// a share has no current directory: \\srv\sh is its root, \\srv\sh\
+	rooted := len(rest) > 0 && f.isSep(rest[0]) || f.isUNC(vol)
+
+	var elems []string
+	for _, e := range f.elements(rest) {
+		switch {
+		case e == ".":
+		case e != "..":
+			elems = append(elems, e)
+		case len(elems) > 0 && elems[len(elems)-1] != "..":
+			elems = elems[:len(elems)-1]
+		case !rooted && (vol == "" || f.isDrive(vol)):
+			elems = append(elems, "..") // a relative path keeps leading ..
+		}
+	}
+	// "a/../c:" cleans to "c:", which is a drive, so Windows needs ".\c:"
+	if f.windows && vol == "" && !rooted && len(elems) > 0 && f.volumeLen(elems[0]) > 0 {
+		elems = append([]string{"."}, elems...)
+	}
+
+	sep := string(f.separator)
+	out := vol
+	if rooted {
+		out += sep
+	}
+	out += strings.Join(elems, sep)
+	if out == "" || out == vol && f.isDrive(vol) {
+		out += "."
+	}
+	return out
+}
+
+// method that splits a path (without the volume) into its non-empty elements
+func (f flavor) elements(p string) []string {
+	return strings.FieldsFunc(p, func(r rune) bool { return r < 0x80 && f.isSep(byte(r)) })
+}
+
+// method that joins the elements with the separator and cleans the result.
+// Like filepath.Join(), an absolute element doesn't reset the path: join("a", "/b") == "a/b".
+func (f flavor) join(elem ...string) string {
+	var b strings.Builder
+	for _, e := range elem {
+		if e == "" {
+			continue
+		}
+		// join("C:", "x") is C:x (relative to the current directory of C:), not C:\x
+		if b.Len() > 0 && !(f.windows && b.Len() == 2 && f.volumeLen(b.String()) == 2) {
+			b.WriteByte(f.separator)
+		}
+		b.WriteString(e)
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return f.clean(b.String())
+}
+
+// method that splits p after the last separator: split(`C:\a\b.txt`) => `C:\a\`, "b.txt"
+func (f flavor) split(p string) (dir, file string) {
+	n := f.volumeLen(p)
+	i := len(p) - 1
+	for i >= n && !f.isSep(p[i]) {
+		i--
+	}
+	return p[:i+1], p[i+1:]
+}
+
+// method that returns the last element of p
+func (f flavor) base(p string) string {
+	if p == "" {
+		return "."
+	}
+	p = p[f.volumeLen(p):]
+	for len(p) > 0 && f.isSep(p[len(p)-1]) {
+		p = p[:len(p)-1]
+	}
+	if p == "" {
+		return string(f.separator)
+	}
+	_, file := f.split(p)
+	return file
+}
+
+// method that returns all but the last element of p, cleaned
+func (f flavor) dir(p string) string {
+	n := f.volumeLen(p)
+	dir, _ := f.split(p)
+	rest := f.clean(dir[n:])
+	if rest == "." && n > 0 {
+		rest = ""
+		if len(dir) > n {
+			rest = string(f.separator)
+		}
+	}
+	return f.clean(p[:n] + rest)
+}
+
+/////////////////////////////////
+// Comparing and Rel
+/////////////////////////////////
+
+// method that compares two names with the rules of the flavor: Windows file names are case-insensitive
+func (f flavor) equalName(a, b string) bool {
+	if f.windows {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// method that reports if two paths name the same file (without touching the disk)
+func (f flavor) equal(a, b string) bool {
+	return f.equalName(f.clean(a), f.clean(b))
+}
+
+// method that returns targ relative to base, with the rules of filepath.Rel()
+func (f flavor) rel(base, targ string) (string, error) {
+	base, targ = f.clean(base), f.clean(targ)
+	if f.equalName(base, targ) {
+		return ".", nil
+	}
+	bn, tn := f.volumeLen(base), f.volumeLen(targ)
+	if !f.equalName(base[:bn], targ[:tn]) {
+		return "", fmt.Errorf("%s: can't make %s relative to %s: different volumes", f.name, targ, base)
+	}
+	bRest, tRest := base[bn:], targ[tn:]
+	bRooted := len(bRest) > 0 && f.isSep(bRest[0])
+	tRooted := len(tRest) > 0 && f.isSep(tRest[0])
+	if bRooted != tRooted {
+		return "", fmt.Errorf("%s: can't make %s relative to %s", f.name, targ, base)
+	}
+
+	bElems := cleanElems(f.elements(bRest))
+	tElems := cleanElems(f.elements(tRest))
+	i := 0
+	for i < len(bElems) && i < len(tElems) && f.equalName(bElems[i], tElems[i]) {
+		i++
+	}
+	for _, e := range bElems[i:] {
+		if e == ".." {
+			// base is ../x and targ is y: we can't know the name of the directory above
+			return "", fmt.Errorf("%s: can't make %s relative to %s", f.name, targ, base)
+		}
+	}
+	var out []string
+	for range bElems[i:] {
+		out = append(out, "..")
+	}
+	out = append(out, tElems[i:]...)
+	if len(out) == 0 {
+		return ".", nil
+	}
+	return strings.Join(out, string(f.separator)), nil
+}
+
+// a helper function that removes the "." of a cleaned relative path
+func cleanElems(elems []string) []string {
+	if len(elems) == 1 && elems[0] == "." {
+		return nil
+	}
+	return elems
+}
+
+/////////////////////////////////
+// Converting Between Flavors
+/////////////////////////////////
+
+// Drive letters are mapped under a mount directory, like WSL does: C:\Users => /mnt/c/Users
+// UNC paths keep the leading double slash: \\server\share\x => //server/share/x
+// Names that Windows can't store are rejected instead of being silently changed.
+
+var (
+	errDriveRelative = errors.New("drive-relative paths (C:x) can't be converted")
+	errInvalidName   = errors.New("name is not valid on windows")
+)
+
+// declaring a function that converts a Windows path to a POSIX path
+func toPOSIX(p, mount string) (string, error) {
+	p = windows.clean(p)
+	// \\?\C:\x => C:\x and \\?\UNC\server\share => \\server\share
+	if len(p) >= 4 && p[:4] == `\\?\` {
+		if len(p) >= 8 && strings.EqualFold(p[4:8], `UNC\`) {
+			p = `\\` + p[8:]
+		} else {
+			p = p[4:]
+		}
+	}
+	n := windows.volumeLen(p)
+	vol, rest := p[:n], strings.ReplaceAll(p[n:], `\`, "/")
+	switch {
+	case vol == "":
+		return posix.clean(rest), nil // relative, or rooted on the current drive
+	case windows.isDrive(vol):
+		if !windows.isAbs(p) {
+			return "", fmt.Errorf("%q: %w", p, errDriveRelative)
+		}
+		return posix.join(mount, strings.ToLower(vol[:1]), rest), nil
+	case strings.HasPrefix(vol, `\\.\`):
+		return "", fmt.Errorf("%q: device paths can't be converted", p)
+	default:
+		// posix.clean() would turn the leading // into /
+		return "/" + posix.clean(strings.ReplaceAll(vol, `\`, "/")+rest), nil
+	}
+}
+
+// declaring a function that converts a POSIX path to a Windows path
+func toWindows(p, mount string) (string, error) {
+	unc := strings.HasPrefix(p, "//") && !strings.HasPrefix(p, "///")
+	p = posix.clean(p)
+	for _, e := range posix.elements(p) {
+		if err := checkWindowsName(e); err != nil {
+			return "", fmt.Errorf("%q: %w", p, err)
+		}
+	}
+	mount = posix.clean(mount)
+	if rest, ok := strings.CutPrefix(p, mount+"/"); ok && len(rest) >= 1 && isLetter(rest[0]) && (len(rest) == 1 || rest[1] == '/') {
+		return windows.clean(strings.ToUpper(rest[:1]) + `:\` + rest[1:]), nil
+	}
+	if unc {
+		return windows.clean(`\` + p), nil
+	}
+	return windows.clean(p), nil
+}
+
+// a helper function that checks a single name against the Windows rules
+func checkWindowsName(name string) error {
+	if name == "." || name == ".." {
+		return nil
+	}
+	for _, r := range name {
+		if r < 32 || strings.ContainsRune(`<>:"\|?*`, r) {
+			return fmt.Errorf("%w: %q contains %q", errInvalidName, name, r)
+		}
+	}
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		return fmt.Errorf("%w: %q ends with a dot or a space", errInvalidName, name)
+	}
+	// reserved device names, also with an extension: nul.txt is the NUL device
+	stem, _, _ := strings.Cut(strings.ToUpper(name), ".")
+	stem = strings.TrimRight(stem, " ")
+	switch stem {
+	case "CON", "PRN", "AUX", "NUL":
+		return fmt.Errorf("%w: %q is a reserved device name", errInvalidName, name)
+	}
+	if len(stem) == 4 && (stem[:3] == "COM" || stem[:3] == "LPT") && '1' <= stem[3] && stem[3] <= '9' {
+		return fmt.Errorf("%w: %q is a reserved device name", errInvalidName, name)
+	}
+	return nil
+}
+
+func main() {
+	// THE PROBLEM
+	fmt.Println(filepath.Clean(`C:\Users\..\Andrei`)) // => C:\Users\..\Andrei (on Linux)
+	fmt.Println(windows.clean(`C:\Users\..\Andrei`))  // => C:\Andrei
+
+	// CLEAN
+	for _, p := range []string{`C:/Users//Andrei/./Documents/`, `C:\..\..\Windows`, `C:..\x`, `\\server\share\a\..\..\b`,
+		`\\?\C:\very\long\path`, `a/../c:`, `C:`, ``} {
+		fmt.Printf("%-30q => %q\n", p, windows.clean(p))
+	}
+	// => "C:/Users//Andrei/./Documents/" => "C:\\Users\\Andrei\\Documents"
+	// => "C:\\..\\..\\Windows"          => "C:\\Windows"
+	// => "C:..\\x"                      => "C:..\\x"
+	// => "\\\\server\\share\\a\\..\\..\\b" => "\\\\server\\share\\b"
+	// => "\\\\?\\C:\\very\\long\\path"  => "\\\\?\\C:\\very\\long\\path"
+	// => "a/../c:"                      => ".\\c:"
+	// => "C:"                           => "C:."
+	// => ""                             => "."
+	fmt.Println(posix.clean(`/home//andrei/../x/`), posix.clean(`C:\Users`)) // => /home/x C:\Users
+
+	// VOLUMES AND ABSOLUTE PATHS
+	for _, p := range []string{`C:\Users`, `C:Users`, `\Users`, `\\server\share\x`, `//server/share`, `\\?\UNC\srv\sh\x`} {
+		fmt.Printf("%-20s volume %-16q abs %v\n", p, windows.volumeName(p), windows.isAbs(p))
+	}
+	// => C:\Users            volume "C:"             abs true
+	// => C:Users             volume "C:"             abs false
+	// => \Users              volume ""               abs false
+	// => \\server\share\x    volume "\\\\server\\share" abs true
+	// => //server/share      volume "\\\\server\\share" abs true
+	// => \\?\UNC\srv\sh\x    volume "\\\\?\\UNC\\srv\\sh" abs true
+
+	// JOIN, SPLIT, BASE, DIR
+	fmt.Println(windows.join(`C:\Users`, "Andrei", `..\Public`, "a.txt")) // => C:\Users\Public\a.txt
+	fmt.Println(windows.join("C:", "x"), windows.join(`\\srv\sh`, "x"))   // => C:x \\srv\sh\x
+	fmt.Println(posix.join("/home", "andrei", "../x"))                    // => /home/x
+	fmt.Println(windows.split(`C:\Users\a.txt`))                          // => C:\Users\ a.txt
+	fmt.Println(windows.base(`C:\Users\`), windows.base(`C:\`))           // => Users \
+	fmt.Println(windows.dir(`C:\Users\a.txt`), windows.dir(`C:\a.txt`))   // => C:\Users C:\
+	fmt.Println(windows.dir(`\\srv\sh\a.txt`), posix.dir("/a.txt"))       // => \\srv\sh\ /
+
+	// CASE-INSENSITIVE COMPARISON
+	fmt.Println(windows.equal(`C:\Users\ANDREI\`, `c:/users/andrei`))              // => true
+	fmt.Println(windows.clean(`\\srv\sh`), windows.equal(`\\srv\sh`, `\\SRV\sh\`)) // => \\srv\sh\ true
+	fmt.Println(posix.equal("/home/Andrei", "/home/andrei"))                       // => false
+
+	// REL
+	rel := func(f flavor, base, targ string) {
+		r, err := f.rel(base, targ)
+		fmt.Printf("%-8s %q %q => %q %v\n", f.name, base, targ, r, err)
+	}
+	rel(windows, `C:\Users\Andrei`, `c:\users\andrei\Documents\a.txt`)
+	rel(windows, `C:\Users\Andrei`, `C:\Windows`)
+	rel(windows, `C:\Users`, `D:\Users`)
+	rel(windows, `\\srv\sh`, `\\srv\sh\x`)
+	rel(posix, "/home/andrei", "/etc/hosts")
+	rel(posix, "../a", "b")
+	// => windows  "C:\\Users\\Andrei" "c:\\users\\andrei\\Documents\\a.txt" => "Documents\\a.txt" <nil>
+	// => windows  "C:\\Users\\Andrei" "C:\\Windows" => "..\\..\\Windows" <nil>
+	// => windows  "C:\\Users" "D:\\Users" => "" windows: can't make D:\Users relative to C:\Users: different volumes
+	// => windows  "\\\\srv\\sh" "\\\\srv\\sh\\x" => "x" <nil>
+	// => posix    "/home/andrei" "/etc/hosts" => "../../etc/hosts" <nil>
+	// => posix    "../a" "b" => "" posix: can't make b relative to ../a
+
+	// CONVERTING
+	for _, p := range []string{`C:\Users\Andrei\a.txt`, `docs\a.txt`, `\\server\share\x`, `\\?\D:\data`, `C:x`} {
+		r, err := toPOSIX(p, "/mnt")
+		fmt.Printf("%-22s => %q %v\n", p, r, err)
+	}
+	// => C:\Users\Andrei\a.txt  => "/mnt/c/Users/Andrei/a.txt" <nil>
+	// => docs\a.txt             => "docs/a.txt" <nil>
+	// => \\server\share\x       => "//server/share/x" <nil>
+	// => \\?\D:\data            => "/mnt/d/data" <nil>
+	// => C:x                    => "" "C:x": drive-relative paths (C:x) can't be converted
+
+	for _, p := range []string{"/mnt/c/Users/Andrei", "/mnt/c", "//server/share/x", "/etc/hosts", "notes/a:b.txt", "logs/nul.txt", "a/b. "} {
+		r, err := toWindows(p, "/mnt")
+		fmt.Printf("%-20s => %q %v\n", p, r, err)
+	}
+	// => /mnt/c/Users/Andrei  => "C:\\Users\\Andrei" <nil>
+	// => /mnt/c               => "C:\\" <nil>
+	// => //server/share/x     => "\\\\server\\share\\x" <nil>
+	// => /etc/hosts           => "\\etc\\hosts" <nil>
+	// => notes/a:b.txt        => "" "notes/a:b.txt": name is not valid on windows: "a:b.txt" contains ':'
+	// => logs/nul.txt         => "" "logs/nul.txt": name is not valid on windows: "nul.txt" is a reserved device name
+	// => a/b.                 => "" "a/b. ": name is not valid on windows: "b. " ends with a dot or a space
+}
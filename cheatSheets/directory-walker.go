@@ -0,0 +1,435 @@
+/////////////////////////////////
+// Walking Directories with fs.WalkDir, ** Globs and Ignore Files (a `find`-like command)
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+// Execute: go run directory-walker.go [options] [root]
+
+// Examples:
+// go run directory-walker.go -name '**/*.go' .
+// go run directory-walker.go -type d -maxdepth 2 /usr/lib
+// go run directory-walker.go -exclude '**/testdata/**' -ignore .gitignore -L -j 8 ~/src
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+/////////////////////////////////
+// Glob Patterns with **
+/////////////////////////////////
+
+// path.Match() matches one path element at a time: * never matches a /
+// We split the pattern and the path into elements and let ** match zero or more elements.
+func matchGlob(pattern, name string) bool {
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// ** at the end matches everything that's left
+			if len(pattern) == 1 {
+				return true
+			}
+			// trying to match the rest of the pattern at every position
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+/////////////////////////////////
+// .gitignore-style Rules
+/////////////////////////////////
+
+// declaring a struct type for one line of an ignore file
+type ignoreRule struct {
+	base    string // the directory of the ignore file, the pattern is relative to it
+	pattern string
+	negate  bool // !pattern re-includes a path
+	dirOnly bool // pattern/ matches only directories
+}
+
+// declaring a function that parses an ignore file
+// a missing ignore file is not an error, it simply has no rules.
+func readIgnoreFile(dir, name string) ([]ignoreRule, error) {
+	file, err := os.Open(filepath.Join(dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r := ignoreRule{base: dir}
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		// a pattern without a slash matches a name at any depth: *.log == **/*.log
+		if !strings.Contains(line, "/") {
+			line = "**/" + line
+		}
+		r.pattern = strings.TrimPrefix(line, "/")
+		rules = append(rules, r)
+	}
+	return rules, scanner.Err()
+}
+
+// declaring a function that applies the rules in order, the last matching rule wins.
+func ignored(rules []ignoreRule, p string, isDir bool) bool {
+	result := false
+	for _, r := range rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(r.base, p)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if matchGlob(r.pattern, filepath.ToSlash(rel)) {
+			result = !r.negate
+		}
+	}
+	return result
+}
+
+/////////////////////////////////
+// The Walker
+/////////////////////////////////
+
+// declaring a defined type for what the walker does with symbolic links
+type symlinkPolicy int
+
+const (
+	symlinkList   symlinkPolicy = iota // report symlinks as entries but don't follow them (like find)
+	symlinkSkip                        // don't report symlinks at all
+	symlinkFollow                      // follow symlinks to directories, detecting loops (like find -L)
+)
+
+// declaring a struct type with the walker options
+type walkOptions struct {
+	include    []string // ** globs, relative to the root; if set, only matching entries are reported
+	exclude    []string // ** globs, matching entries are not reported and directories are not entered
+	ignoreFile string   // name of the .gitignore-style file read in every directory, "" to disable
+	maxDepth   int      // the root is depth 0, a negative value means no limit
+	symlinks   symlinkPolicy
+	workers    int // max. number of directories read at the same time
+}
+
+// declaring a struct type for the values sent into the results channel
+type walkEntry struct {
+	path  string
+	depth int
+	entry fs.DirEntry
+	err   error
+}
+
+// the device and inode numbers identify a directory, even if it's reached through different paths
+type fileID struct {
+	dev, ino uint64
+}
+
+type walker struct {
+	root string
+	opts walkOptions
+	out  chan walkEntry
+	done chan struct{} // closed by the consumer to stop the walk early
+
+	sem chan struct{} // a counting semaphore that bounds the number of worker goroutines
+	wg  sync.WaitGroup
+}
+
+// declaring a function that starts walking root and streams the entries on a channel.
+// the channel is closed when the walk is complete; closing done stops the walk early.
+func walk(root string, opts walkOptions, done chan struct{}) <-chan walkEntry {
+	if opts.workers < 1 {
+		opts.workers = 1
+	}
+	w := &walker{
+		root: root,
+		opts: opts,
+		out:  make(chan walkEntry),
+		done: done,
+		sem:  make(chan struct{}, opts.workers),
+	}
+
+	w.sem <- struct{}{}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer func() { <-w.sem }()
+		rules, err := w.loadRules(nil, root)
+		if err != nil {
+			w.send(walkEntry{path: root, err: err})
+		}
+		w.walkDir(root, 0, rules, nil)
+	}()
+
+	// closing the channel once every directory was walked
+	go func() {
+		w.wg.Wait()
+		close(w.out)
+	}()
+	return w.out
+}
+
+// method that sends an entry or returns false if the consumer stopped the walk
+func (w *walker) send(e walkEntry) bool {
+	select {
+	case w.out <- e:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// a helper function that appends dir to the chain of its ancestors; it returns false if dir is one of them (a loop).
+// A directory reached through two different symlinks is not a loop: only the path from the root to dir is checked.
+func enter(ancestors []fileID, dir string) ([]fileID, bool) {
+	fileInfo, err := os.Stat(dir)
+	if err != nil {
+		return ancestors, true
+	}
+	st, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ancestors, true
+	}
+	id := fileID{uint64(st.Dev), uint64(st.Ino)}
+	if slices.Contains(ancestors, id) {
+		return ancestors, false
+	}
+	// clipping the slice so that sibling directories don't share the backing array
+	return append(slices.Clip(ancestors), id), true
+}
+
+// method that walks a subdirectory in a new worker goroutine if one is free, or in the current goroutine otherwise.
+// The number of goroutines is bounded by opts.workers, not by the size of the tree.
+func (w *walker) spawn(dir string, depth int, rules []ignoreRule, ancestors []fileID) {
+	select {
+	case w.sem <- struct{}{}:
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			defer func() { <-w.sem }()
+			w.walkDir(dir, depth, rules, ancestors)
+		}()
+	default:
+		w.walkDir(dir, depth, rules, ancestors)
+	}
+}
+
+// method that appends the rules of the ignore file found in dir to the parent rules
+func (w *walker) loadRules(parent []ignoreRule, dir string) ([]ignoreRule, error) {
+	if w.opts.ignoreFile == "" {
+		return parent, nil
+	}
+	rules, err := readIgnoreFile(dir, w.opts.ignoreFile)
+	if err != nil || len(rules) == 0 {
+		return parent, err
+	}
+	// copying the slice so that sibling directories don't share the backing array
+	return append(append([]ignoreRule(nil), parent...), rules...), nil
+}
+
+// method that checks the include and exclude globs
+func (w *walker) matches(globs []string, p string) bool {
+	rel, err := filepath.Rel(w.root, p)
+	if err != nil {
+		return false
+	}
+	for _, g := range globs {
+		if matchGlob(g, filepath.ToSlash(rel)) {
+			return true
+		}
+	}
+	return false
+}
+
+// method that walks one directory level with fs.WalkDir
+// subdirectories are not walked by fs.WalkDir, they are handed to spawn() so that they are read in parallel.
+func (w *walker) walkDir(dir string, depth int, rules []ignoreRule, ancestors []fileID) {
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+
+	ancestors, ok := enter(ancestors, dir)
+	if !ok {
+		w.send(walkEntry{path: dir, depth: depth, err: fmt.Errorf("%s: symlink loop detected", dir)})
+		return
+	}
+
+	// os.DirFS returns a read-only file system (an fs.FS) rooted at dir
+	err := fs.WalkDir(os.DirFS(dir), ".", func(name string, d fs.DirEntry, err error) error {
+		p := filepath.Join(dir, name)
+		if err != nil {
+			if !w.send(walkEntry{path: p, depth: depth, err: err}) {
+				return fs.SkipAll
+			}
+			return nil
+		}
+		if name == "." {
+			// the root is reported only by the worker that walks it, not by its subdirectories
+			if depth > 0 || (len(w.opts.include) > 0 && !w.matches(w.opts.include, p)) {
+				return nil
+			}
+			if !w.send(walkEntry{path: p, depth: 0, entry: d}) {
+				return fs.SkipAll
+			}
+			return nil
+		}
+		if w.opts.maxDepth >= 0 && depth+1 > w.opts.maxDepth {
+			return fs.SkipAll // the entries of dir are deeper than maxdepth: -maxdepth 0 reports only the root
+		}
+
+		isDir := d.IsDir()
+		isLink := d.Type()&fs.ModeSymlink != 0
+		if isLink && w.opts.symlinks == symlinkSkip {
+			return nil
+		}
+		if isLink && w.opts.symlinks == symlinkFollow {
+			if fileInfo, err := os.Stat(p); err == nil && fileInfo.IsDir() {
+				isDir = true
+			}
+		}
+
+		if w.matches(w.opts.exclude, p) || ignored(rules, p, isDir) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if len(w.opts.include) == 0 || w.matches(w.opts.include, p) {
+			if !w.send(walkEntry{path: p, depth: depth + 1, entry: d}) {
+				return fs.SkipAll
+			}
+		}
+
+		if isDir {
+			if w.opts.maxDepth < 0 || depth+1 < w.opts.maxDepth {
+				sub, err := w.loadRules(rules, p)
+				if err != nil {
+					w.send(walkEntry{path: p, depth: depth + 1, err: err})
+				}
+				w.spawn(p, depth+1, sub, ancestors)
+			}
+			if d.IsDir() {
+				return fs.SkipDir // WalkDir must not enter it, spawn() did
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		w.send(walkEntry{path: dir, depth: depth, err: err})
+	}
+}
+
+/////////////////////////////////
+// The find-like Command
+/////////////////////////////////
+
+// declaring a defined type that implements flag.Value so that a flag can be repeated
+type stringList []string
+
+func (s *stringList) String() string     { return strings.Join(*s, ",") }
+func (s *stringList) Set(v string) error { *s = append(*s, v); return nil }
+
+func main() {
+	var include, exclude stringList
+	flag.Var(&include, "name", "report only paths matching this ** glob (repeatable)")
+	flag.Var(&exclude, "exclude", "skip paths matching this ** glob (repeatable)")
+	ignoreFile := flag.String("ignore", "", "name of a .gitignore-style file read in every directory")
+	maxDepth := flag.Int("maxdepth", -1, "descend at most this many levels (-1 = no limit)")
+	fileType := flag.String("type", "", "report only files (f), directories (d) or symlinks (l)")
+	follow := flag.Bool("L", false, "follow symbolic links")
+	noLinks := flag.Bool("nolinks", false, "don't report symbolic links")
+	workers := flag.Int("j", 4, "number of directories read in parallel")
+	flag.Parse()
+
+	root := "."
+	if flag.NArg() > 0 {
+		root = flag.Arg(0)
+	}
+
+	opts := walkOptions{
+		include:    include,
+		exclude:    exclude,
+		ignoreFile: *ignoreFile,
+		maxDepth:   *maxDepth,
+		workers:    *workers,
+	}
+	switch {
+	case *follow:
+		opts.symlinks = symlinkFollow
+	case *noLinks:
+		opts.symlinks = symlinkSkip
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// the results come in the order in which the workers find them, not sorted
+	for e := range walk(root, opts, done) {
+		if e.err != nil {
+			log.Println(e.err)
+			continue
+		}
+		switch *fileType {
+		case "f":
+			if !e.entry.Type().IsRegular() {
+				continue
+			}
+		case "d":
+			if !e.entry.IsDir() {
+				continue
+			}
+		case "l":
+			if e.entry.Type()&fs.ModeSymlink == 0 {
+				continue
+			}
+		}
+		fmt.Println(e.path)
+	}
+}
@@ -0,0 +1,406 @@
+/////////////////////////////////
+// Disk Usage Analyzer (like du and ncdu)
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+
+// Execute:
+// go run disk-usage.go [-depth 2] <dir>                    sorted tree
+// go run disk-usage.go -top 10 <dir>                       the 10 largest directories and files
+// go run disk-usage.go -json <dir>                         the whole tree as JSON
+// go run disk-usage.go -browse <dir>                       interactive drill-down
+// Other options: -apparent (sort by apparent size), -x (stay on one filesystem), -j 8 (directories scanned in parallel)
+
+// fileInfo.Size() is the APPARENT size: the number of bytes you can read from the file.
+// The ALLOCATED size is the space the file takes on disk, stat.Blocks * 512 bytes:
+// - it's usually bigger: a 1 byte file uses a whole 4 KB block
+// - it's smaller for sparse files: a file with holes (created by Truncate() or Seek()) has no blocks for the holes
+// Hardlinks are the same file with many names: like du, only the first name found is counted.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+/////////////////////////////////
+// Scanning
+/////////////////////////////////
+
+// declaring a struct type for a file or directory of the tree
+type node struct {
+	Name      string  `json:"name"`
+	Apparent  int64   `json:"apparent"`  // fileInfo.Size(), for directories the sum of the tree
+	Allocated int64   `json:"allocated"` // stat.Blocks * 512, for directories the sum of the tree
+	Files     int     `json:"files"`
+	IsDir     bool    `json:"dir,omitempty"`
+	Hardlink  bool    `json:"hardlink,omitempty"` // another name of this file was already counted
+	Err       string  `json:"error,omitempty"`
+	Children  []*node `json:"children,omitempty"`
+	path      string
+	parent    *node
+}
+
+// the identity of a file on the machine: the inode number is unique only on its filesystem
+type fileID struct {
+	dev, ino uint64
+}
+
+// declaring a struct type that holds the state shared by all the goroutines of a scan
+type scanner struct {
+	oneFS  bool
+	rootID uint64
+	sem    chan struct{} // limits the number of directories read at the same time
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	seen   map[fileID]bool // hardlinked files already counted
+	errors int
+}
+
+// declaring a function that scans the tree at root
+func scan(root string, oneFS bool, workers int) (*node, int, error) {
+	fileInfo, err := os.Lstat(root)
+	if err != nil {
+		return nil, 0, err
+	}
+	s := &scanner{oneFS: oneFS, sem: make(chan struct{}, workers), seen: make(map[fileID]bool)}
+	s.rootID = uint64(fileInfo.Sys().(*syscall.Stat_t).Dev)
+
+	n := &node{Name: root, path: root}
+	s.add(n, fileInfo)
+	if n.IsDir {
+		s.scanDir(n)
+	}
+	s.wg.Wait()
+	sum(n)
+	return n, s.errors, nil
+}
+
+// method that sets the sizes of a single file or directory (without its children)
+func (s *scanner) add(n *node, fileInfo os.FileInfo) {
+	stat := fileInfo.Sys().(*syscall.Stat_t)
+	n.IsDir = fileInfo.IsDir()
+	if !n.IsDir && stat.Nlink > 1 {
+		id := fileID{uint64(stat.Dev), stat.Ino}
+		s.mu.Lock()
+		counted := s.seen[id]
+		s.seen[id] = true
+		s.mu.Unlock()
+		if counted {
+			n.Hardlink = true
+			return
+		}
+	}
+	// a file with several hardlinks is counted once, like its size
+	if !n.IsDir {
+		n.Files = 1
+	}
+	n.Apparent = fileInfo.Size()
+	n.Allocated = stat.Blocks * 512 // st_blocks is ALWAYS in 512-byte units, whatever the block size of the filesystem
+}
+
+// method that reads a directory and scans its subdirectories
+// Every goroutine writes only to its own node, so the tree needs no mutex.
+func (s *scanner) scanDir(n *node) {
+	entries, err := os.ReadDir(n.path)
+	if err != nil {
+		n.Err = err.Error()
+		s.mu.Lock()
+		s.errors++
+		s.mu.Unlock()
+	}
+	for _, e := range entries {
+		child := &node{Name: e.Name(), path: filepath.Join(n.path, e.Name()), parent: n}
+		fileInfo, err := e.Info() // the same as os.Lstat(): symlinks are not followed
+		if err != nil {
+			continue // the file was removed after ReadDir()
+		}
+		n.Children = append(n.Children, child)
+		s.add(child, fileInfo)
+		if !child.IsDir {
+			continue
+		}
+		if s.oneFS && uint64(fileInfo.Sys().(*syscall.Stat_t).Dev) != s.rootID {
+			child.Err = "other filesystem, skipped"
+			continue // a mount point: /proc, /sys, a USB drive, ...
+		}
+
+		// scanning in a new goroutine if there's a free slot, else in this one
+		// (waiting for a slot while holding one could block all the workers forever)
+		select {
+		case s.sem <- struct{}{}:
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				defer func() { <-s.sem }()
+				s.scanDir(child)
+			}()
+		default:
+			s.scanDir(child)
+		}
+	}
+}
+
+// declaring a recursive function that adds the sizes of the children to the directories
+func sum(n *node) {
+	for _, c := range n.Children {
+		sum(c)
+		n.Apparent += c.Apparent
+		n.Allocated += c.Allocated
+		n.Files += c.Files
+	}
+}
+
+/////////////////////////////////
+// Reports
+/////////////////////////////////
+
+// a helper function that formats a size like du -h
+func humanSize(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// a helper function that returns the size used for sorting
+func size(n *node, apparent bool) int64 {
+	if apparent {
+		return n.Apparent
+	}
+	return n.Allocated
+}
+
+func sortChildren(n *node, apparent bool) {
+	sort.Slice(n.Children, func(i, j int) bool {
+		a, b := size(n.Children[i], apparent), size(n.Children[j], apparent)
+		if a != b {
+			return a > b
+		}
+		return n.Children[i].Name < n.Children[j].Name
+	})
+}
+
+// a helper function that draws a bar of 10 characters
+func bar(part, total int64) string {
+	filled := 0
+	if total > 0 {
+		filled = int(part * 10 / total)
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(" ", 10-filled) + "]"
+}
+
+// declaring a function that prints the tree sorted by size, down to depth levels
+func printTree(w io.Writer, n *node, apparent bool, depth int) {
+	var walk func(n *node, indent string, level int)
+	walk = func(n *node, indent string, level int) {
+		sortChildren(n, apparent)
+		children := n.Children
+		if level > 0 {
+			children = nil // only directories below the first level
+			for _, c := range n.Children {
+				if c.IsDir {
+					children = append(children, c)
+				}
+			}
+		}
+		for i, c := range children {
+			branch, next := "├── ", "│   "
+			if i == len(children)-1 {
+				branch, next = "└── ", "    "
+			}
+			name := c.Name
+			if c.IsDir {
+				name += "/"
+			}
+			if c.Err != "" {
+				name += " (" + c.Err + ")"
+			}
+			fmt.Fprintf(w, "%8s %8s %s %s%s%s\n", humanSize(c.Allocated), humanSize(c.Apparent),
+				bar(size(c, apparent), size(n, apparent)), indent, branch, name)
+			if level+1 < depth {
+				walk(c, indent+next, level+1)
+			}
+		}
+	}
+	fmt.Fprintf(w, "%8s %8s %s %s (%d files)\n", "DISK", "APPARENT", bar(0, 0), n.Name, n.Files)
+	fmt.Fprintf(w, "%8s %8s %s\n", humanSize(n.Allocated), humanSize(n.Apparent), bar(1, 1))
+	walk(n, "", 0)
+}
+
+// declaring a function that prints the largest directories and files of the tree
+func printTop(w io.Writer, root *node, apparent bool, top int) {
+	var dirs, files []*node
+	var walk func(n *node)
+	walk = func(n *node) {
+		for _, c := range n.Children {
+			if c.IsDir {
+				dirs = append(dirs, c)
+				walk(c)
+			} else {
+				files = append(files, c)
+			}
+		}
+	}
+	walk(root)
+
+	for _, group := range []struct {
+		title string
+		nodes []*node
+	}{{"Largest directories:", dirs}, {"Largest files:", files}} {
+		sort.Slice(group.nodes, func(i, j int) bool {
+			return size(group.nodes[i], apparent) > size(group.nodes[j], apparent)
+		})
+		fmt.Fprintln(w, group.title)
+		for i, n := range group.nodes {
+			if i == top {
+				break
+			}
+			fmt.Fprintf(w, "%8s  %s\n", humanSize(size(n, apparent)), n.path)
+		}
+	}
+}
+
+/////////////////////////////////
+// Interactive Drill-Down
+/////////////////////////////////
+
+// declaring a function that lets the user navigate the tree: a number enters a directory, u goes up, q quits
+func browse(in io.Reader, w io.Writer, root *node, apparent bool) {
+	scanner := bufio.NewScanner(in)
+	current := root
+	for {
+		sortChildren(current, apparent)
+		fmt.Fprintf(w, "\n--- %s  %s (%d files)\n", current.path, humanSize(size(current, apparent)), current.Files)
+		for i, c := range current.Children {
+			name := c.Name
+			if c.IsDir {
+				name += "/"
+			}
+			if c.Hardlink {
+				name += " (hardlink, counted once)"
+			}
+			fmt.Fprintf(w, "%3d %8s %s %s\n", i+1, humanSize(size(c, apparent)), bar(size(c, apparent), size(current, apparent)), name)
+		}
+		fmt.Fprint(w, "number = open, u = up, q = quit > ")
+
+		if !scanner.Scan() {
+			fmt.Fprintln(w)
+			return
+		}
+		input := strings.TrimSpace(scanner.Text())
+		switch {
+		case input == "q":
+			return
+		case input == "u" || input == "..":
+			if current.parent != nil {
+				current = current.parent
+			}
+		default:
+			i, err := strconv.Atoi(input)
+			if err != nil || i < 1 || i > len(current.Children) {
+				fmt.Fprintln(w, "invalid choice:", input)
+				continue
+			}
+			if !current.Children[i-1].IsDir {
+				fmt.Fprintln(w, "not a directory:", current.Children[i-1].Name)
+				continue
+			}
+			current = current.Children[i-1]
+		}
+	}
+}
+
+func main() {
+	log.SetFlags(0)
+	depth := flag.Int("depth", 1, "number of directory levels printed in the tree")
+	top := flag.Int("top", 0, "print the N largest directories and files instead of the tree")
+	asJSON := flag.Bool("json", false, "print the whole tree as JSON")
+	interactive := flag.Bool("browse", false, "navigate the tree interactively")
+	apparent := flag.Bool("apparent", false, "sort by apparent size instead of disk usage")
+	oneFS := flag.Bool("x", false, "skip directories on other filesystems")
+	workers := flag.Int("j", 8, "number of directories scanned in parallel")
+	flag.Parse()
+
+	root := "."
+	if flag.NArg() > 0 {
+		root = flag.Arg(0)
+	}
+	tree, errors, err := scan(root, *oneFS, *workers)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch {
+	case *asJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(tree); err != nil {
+			log.Fatal(err)
+		}
+		// => {
+		// =>   "name": "project",
+		// =>   "apparent": 11547849,
+		// =>   "allocated": 1073152,
+		// =>   "files": 5,
+		// =>   "dir": true,
+		// =>   "children": [
+		// => ...
+
+	case *top > 0:
+		printTop(os.Stdout, tree, *apparent, *top)
+		// => Largest directories:
+		// =>     1.0M  project/data
+		// =>    12.0K  project/src
+		// => Largest files:
+		// =>     1.0M  project/data/big.bin
+		// =>     4.0K  project/src/main.go
+		// =>     4.0K  project/notes.txt
+
+	case *interactive:
+		browse(os.Stdin, os.Stdout, tree, *apparent)
+		// => --- project  1.0M (5 files)
+		// =>   1     1.0M [######### ] data/
+		// =>   2    12.0K [          ] src/
+		// =>   3     4.0K [          ] notes.txt
+		// =>   4       0B [          ] sparse.img
+		// => number = open, u = up, q = quit > 1
+		// =>
+		// => --- project/data  1.0M (1 files)
+		// =>   1     1.0M [######### ] big.bin
+		// =>   2       0B [          ] link.bin (hardlink, counted once)
+		// => number = open, u = up, q = quit > u
+
+	default:
+		printTree(os.Stdout, tree, *apparent, *depth)
+		// =>     DISK APPARENT [          ] project (5 files)
+		// =>     1.0M    11.0M [##########]
+		// =>     1.0M     1.0M [######### ] ├── data/
+		// =>    12.0K     5.2K [          ] ├── src/
+		// =>     4.0K      12B [          ] ├── notes.txt
+		// =>       0B    10.0M [          ] └── sparse.img
+	}
+	if errors > 0 {
+		fmt.Fprintf(os.Stderr, "%d directories could not be read\n", errors)
+	}
+}
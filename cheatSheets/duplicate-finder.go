@@ -0,0 +1,383 @@
+/////////////////////////////////
+// Finding Duplicate Files and Writing Checksum Manifests (SHA-256)
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+
+// Finding duplicates:
+// go run duplicate-finder.go dupes [-json] [-link] [-j 4] <dir>
+
+// Writing and verifying a manifest (the same format as `sha256sum` and `sha256sum -c`):
+// go run duplicate-finder.go manifest [-j 4] <dir> > SHA256SUMS
+// go run duplicate-finder.go check SHA256SUMS
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// the number of bytes hashed by the fast partial hash
+const partialSize = 4096
+
+// declaring a function that returns the paths and the fs.FileInfo of all the regular files in a tree
+func listFiles(root string) (map[string]fs.FileInfo, error) {
+	files := make(map[string]fs.FileInfo)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() { // skipping directories, symlinks, devices, ...
+			return nil
+		}
+		fileInfo, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[path] = fileInfo
+		return nil
+	})
+	return files, err
+}
+
+// the identity of a file on the machine: the inode number is unique only on its filesystem
+type fileID struct {
+	dev, ino uint64
+}
+
+// declaring a function that keeps one path for every file
+// the hard links of a file share its inode: they are the same file, not duplicates.
+func uniqueFiles(files map[string]fs.FileInfo) map[string]fs.FileInfo {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths) // the first path in alphabetical order represents the file
+
+	unique := make(map[string]fs.FileInfo)
+	seen := make(map[fileID]bool)
+	for _, p := range paths {
+		if stat, ok := files[p].Sys().(*syscall.Stat_t); ok && stat.Nlink > 1 {
+			id := fileID{uint64(stat.Dev), stat.Ino}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+		}
+		unique[p] = files[p]
+	}
+	return unique
+}
+
+// declaring a function that hashes the first limit bytes of a file (limit < 0 means the whole file)
+func hashFile(path string, limit int64) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if limit >= 0 {
+		r = io.LimitReader(file, limit)
+	}
+
+	// sha256.New() returns a hash.Hash, which is an io.Writer; io.Copy() streams the file into it.
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// declaring a struct type for the result of hashing one file
+type hashResult struct {
+	path string
+	sum  string
+	err  error
+}
+
+// declaring a function that hashes files concurrently using a fixed number of worker goroutines
+func hashAll(paths []string, limit int64, workers int) []hashResult {
+	jobs := make(chan string)
+	results := make(chan hashResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				sum, err := hashFile(path, limit)
+				results <- hashResult{path, sum, err}
+			}
+		}()
+	}
+
+	// sending the jobs and closing the channel so that the workers' for loops end
+	go func() {
+		for _, p := range paths {
+			jobs <- p
+		}
+		close(jobs)
+	}()
+
+	// closing results once all the workers have finished
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var all []hashResult
+	for r := range results {
+		all = append(all, r)
+	}
+	return all
+}
+
+// declaring a function that splits the paths into groups with the same hash
+// groups with a single file can't contain duplicates, so they are dropped.
+func groupByHash(paths []string, limit int64, workers int) [][]string {
+	byHash := make(map[string][]string)
+	for _, r := range hashAll(paths, limit, workers) {
+		if r.err != nil {
+			log.Println(r.err)
+			continue
+		}
+		byHash[r.sum] = append(byHash[r.sum], r.path)
+	}
+	var groups [][]string
+	for _, g := range byHash {
+		if len(g) > 1 {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// declaring a struct type for a group of identical files
+type duplicateGroup struct {
+	Size  int64    `json:"size"`
+	Files []string `json:"files"`
+}
+
+// declaring a function that finds duplicates in 3 steps, each one cheaper than the next:
+// 1. files with a different size can't be equal
+// 2. files with the same size but a different partial hash (first 4 KB) can't be equal
+// 3. files with the same full SHA-256 hash are duplicates
+// Files that are already hard links to each other are counted once.
+func findDuplicates(root string, workers int) ([]duplicateGroup, error) {
+	files, err := listFiles(root)
+	if err != nil {
+		return nil, err
+	}
+
+	bySize := make(map[int64][]string)
+	for path, fileInfo := range uniqueFiles(files) {
+		bySize[fileInfo.Size()] = append(bySize[fileInfo.Size()], path)
+	}
+
+	var dupes []duplicateGroup
+	for size, paths := range bySize {
+		if len(paths) < 2 || size == 0 {
+			continue
+		}
+		for _, partial := range groupByHash(paths, partialSize, workers) {
+			candidates := [][]string{partial}
+			// a small file was already hashed completely by the partial hash
+			if size > partialSize {
+				candidates = groupByHash(partial, -1, workers)
+			}
+			for _, g := range candidates {
+				sort.Strings(g)
+				dupes = append(dupes, duplicateGroup{Size: size, Files: g})
+			}
+		}
+	}
+
+	// biggest duplicates first
+	sort.Slice(dupes, func(i, j int) bool {
+		if dupes[i].Size != dupes[j].Size {
+			return dupes[i].Size > dupes[j].Size
+		}
+		return dupes[i].Files[0] < dupes[j].Files[0]
+	})
+	return dupes, nil
+}
+
+// declaring a function that replaces a duplicate with a hard link to the original
+// the link is created under a temporary name and renamed over the duplicate, so the duplicate
+// is never lost if something fails.
+func replaceWithHardlink(original, duplicate string) error {
+	tmp := duplicate + ".tmp-link"
+	if err := os.Link(original, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, duplicate); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+/////////////////////////////////
+// sha256sum Compatible Manifests
+/////////////////////////////////
+
+// declaring a function that writes a line "<hash>  <path>" for every file
+func writeManifest(w io.Writer, root string, workers int) error {
+	files, err := listFiles(root)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+
+	results := hashAll(paths, -1, workers)
+	sort.Slice(results, func(i, j int) bool { return results[i].path < results[j].path })
+
+	bufferedWriter := bufio.NewWriter(w)
+	for _, r := range results {
+		if r.err != nil {
+			return r.err
+		}
+		fmt.Fprintf(bufferedWriter, "%s  %s\n", r.sum, r.path)
+	}
+	return bufferedWriter.Flush()
+}
+
+// declaring a function that verifies the files listed in a manifest
+// it returns the number of files that failed the check.
+func checkManifest(path string, w io.Writer, workers int) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	expected := make(map[string]string)
+	var paths []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// sha256sum writes "hash  path" in text mode and "hash *path" in binary mode
+		line := scanner.Text()
+		if len(line) < 66 || (line[64:66] != "  " && line[64:66] != " *") {
+			return 0, fmt.Errorf("%s: improperly formatted line: %q", path, line)
+		}
+		sum, name := strings.ToLower(line[:64]), line[66:]
+		expected[name] = sum
+		paths = append(paths, name)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	results := hashAll(paths, -1, workers)
+	sort.Slice(results, func(i, j int) bool { return results[i].path < results[j].path })
+
+	failed := 0
+	for _, r := range results {
+		switch {
+		case r.err != nil:
+			failed++
+			fmt.Fprintf(w, "%s: FAILED open or read\n", r.path)
+		case r.sum != expected[r.path]:
+			failed++
+			fmt.Fprintf(w, "%s: FAILED\n", r.path)
+		default:
+			fmt.Fprintf(w, "%s: OK\n", r.path)
+		}
+	}
+	return failed, nil
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		log.Fatal("usage: duplicate-finder.go dupes|manifest|check [options] <path>")
+	}
+
+	// every subcommand has its own set of flags
+	cmd := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	workers := cmd.Int("j", 4, "number of files hashed at the same time")
+	asJSON := cmd.Bool("json", false, "print the duplicates as JSON")
+	link := cmd.Bool("link", false, "replace duplicates with hard links to the first file")
+	cmd.Parse(os.Args[2:])
+	if cmd.NArg() != 1 {
+		log.Fatalf("usage: duplicate-finder.go %s [options] <path>", os.Args[1])
+	}
+	if *workers < 1 {
+		// without workers, hashAll() would wait forever and print nothing
+		log.Fatalf("-j must be at least 1, got %d", *workers)
+	}
+
+	switch os.Args[1] {
+	case "dupes":
+		dupes, err := findDuplicates(cmd.Arg(0), *workers)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *link {
+			for _, g := range dupes {
+				for _, d := range g.Files[1:] {
+					if err := replaceWithHardlink(g.Files[0], d); err != nil {
+						log.Fatal(err)
+					}
+				}
+			}
+		}
+		if *asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(dupes); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		for _, g := range dupes {
+			fmt.Printf("%d bytes x %d files:\n", g.Size, len(g.Files))
+			for _, f := range g.Files {
+				fmt.Println("  ", f)
+			}
+		}
+		// => 1048576 bytes x 2 files:
+		// =>    photos/a.jpg
+		// =>    photos/copy of a.jpg
+
+	case "manifest":
+		if err := writeManifest(os.Stdout, cmd.Arg(0), *workers); err != nil {
+			log.Fatal(err)
+		}
+		// => 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08  photos/a.jpg
+
+	case "check":
+		failed, err := checkManifest(cmd.Arg(0), os.Stdout, *workers)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if failed > 0 {
+			log.Fatalf("WARNING: %d computed checksums did NOT match", failed)
+		}
+		// => photos/a.jpg: OK
+
+	default:
+		log.Fatalf("unknown command %q", os.Args[1])
+	}
+}
@@ -0,0 +1,437 @@
+/////////////////////////////////
+// Authenticated Streaming File Encryption (AES-GCM in Chunks, PBKDF2)
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+
+// Execute:
+// go run file-encryption.go encrypt secret.txt secret.txt.enc
+// go run file-encryption.go decrypt secret.txt.enc secret.txt
+// go run file-encryption.go demo
+// The passphrase is read from the ENCRYPT_PASSPHRASE environment variable or from standard input (twice to encrypt).
+
+// ioutil.ReadFile() loads a whole file into memory; here a file of any size is encrypted 64 KB at a time.
+// Every chunk is sealed with AES-GCM, which encrypts AND authenticates: a changed byte is detected.
+// Authenticating each chunk alone is not enough, an attacker could also:
+// - reorder or duplicate chunks -> every chunk's nonce contains its index
+// - cut the end of the file     -> the last chunk's nonce has a "final" flag
+// - change the header           -> the header is authenticated data of every chunk
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/////////////////////////////////
+// The File Format
+/////////////////////////////////
+
+// header:  "GENC" | version (1) | kdf (1) | iterations (4) | salt (16) | chunk size (4) | nonce prefix (7)
+// chunks:  ciphertext length (4) | ciphertext (plaintext + 16 bytes GCM tag)
+// nonce:   nonce prefix (7) | chunk index (4) | final flag (1) = 12 bytes, the GCM nonce size
+
+const (
+	formatVersion    = 1
+	kdfPBKDF2SHA256  = 1
+	defaultIter      = 600000 // the OWASP recommendation for PBKDF2-HMAC-SHA256
+	defaultChunkSize = 64 * 1024
+	saltSize         = 16
+	prefixSize       = 7
+	headerSize       = 4 + 1 + 1 + 4 + saltSize + 4 + prefixSize
+	maxChunkSize     = 16 << 20 // refusing huge chunks protects the decryption from a malicious header
+	maxIter          = 10000000 // and refusing huge iteration counts: 4 billion would take hours before failing
+)
+
+var magic = []byte("GENC")
+
+var (
+	errFormat    = errors.New("not an encrypted file or unsupported version")
+	errAuth      = errors.New("wrong passphrase or corrupted file")
+	errTruncated = errors.New("file is truncated")
+	errTrailing  = errors.New("unexpected data after the last chunk")
+)
+
+// declaring a struct type for the header
+type header struct {
+	iterations  uint32
+	salt        [saltSize]byte
+	chunkSize   uint32
+	noncePrefix [prefixSize]byte
+}
+
+func (h header) marshal() []byte {
+	b := make([]byte, 0, headerSize)
+	b = append(b, magic...)
+	b = append(b, formatVersion, kdfPBKDF2SHA256)
+	b = binary.BigEndian.AppendUint32(b, h.iterations)
+	b = append(b, h.salt[:]...)
+	b = binary.BigEndian.AppendUint32(b, h.chunkSize)
+	b = append(b, h.noncePrefix[:]...)
+	return b
+}
+
+func unmarshalHeader(b []byte) (header, error) {
+	var h header
+	if len(b) != headerSize || !bytes.Equal(b[:4], magic) || b[4] != formatVersion || b[5] != kdfPBKDF2SHA256 {
+		return h, errFormat
+	}
+	h.iterations = binary.BigEndian.Uint32(b[6:10])
+	copy(h.salt[:], b[10:26])
+	h.chunkSize = binary.BigEndian.Uint32(b[26:30])
+	copy(h.noncePrefix[:], b[30:37])
+	if h.chunkSize == 0 || h.chunkSize > maxChunkSize || h.iterations == 0 || h.iterations > maxIter {
+		return h, errFormat
+	}
+	return h, nil
+}
+
+// declaring a function that derives the 256-bit AES key from the passphrase
+func newAEAD(passphrase string, h header) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, h.salt[:], int(h.iterations), 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key) // a 32-byte key selects AES-256
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// a helper function that builds the nonce of chunk i
+func chunkNonce(h header, i uint32, final bool) []byte {
+	nonce := make([]byte, 0, 12)
+	nonce = append(nonce, h.noncePrefix[:]...)
+	nonce = binary.BigEndian.AppendUint32(nonce, i)
+	if final {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+/////////////////////////////////
+// Encrypting and Decrypting Streams
+/////////////////////////////////
+
+// declaring a function that encrypts r into w
+func encrypt(w io.Writer, r io.Reader, passphrase string) error {
+	h := header{iterations: defaultIter, chunkSize: defaultChunkSize}
+	// crypto/rand returns cryptographically secure random bytes: the salt and nonce prefix must be unique
+	if _, err := rand.Read(h.salt[:]); err != nil {
+		return err
+	}
+	if _, err := rand.Read(h.noncePrefix[:]); err != nil {
+		return err
+	}
+	aead, err := newAEAD(passphrase, h)
+	if err != nil {
+		return err
+	}
+
+	hdr := h.marshal()
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+
+	// a chunk is final when nothing follows it, so we look one byte ahead with Peek()
+	bufferedReader := bufio.NewReaderSize(r, int(h.chunkSize))
+	plain := make([]byte, h.chunkSize)
+	var sealed []byte
+	for i := uint32(0); ; i++ {
+		if i == ^uint32(0) {
+			return errors.New("file too large")
+		}
+		n, err := io.ReadFull(bufferedReader, plain)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		// only the end of the input makes a chunk final: after a read error it would look like a complete file
+		_, peekErr := bufferedReader.Peek(1)
+		if peekErr != nil && peekErr != io.EOF {
+			return peekErr
+		}
+		final := peekErr == io.EOF
+
+		// the header is passed as additional authenticated data: it's not encrypted, but it can't be changed
+		sealed = aead.Seal(sealed[:0], chunkNonce(h, i, final), plain[:n], hdr)
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(sealed)))
+		if _, err := w.Write(length[:]); err != nil {
+			return err
+		}
+		if _, err := w.Write(sealed); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// declaring a function that decrypts r into w
+// ** w receives plaintext before the whole file is verified: an error means the output must be discarded. **
+func decrypt(w io.Writer, r io.Reader, passphrase string) error {
+	bufferedReader := bufio.NewReader(r)
+	hdr := make([]byte, headerSize)
+	if _, err := io.ReadFull(bufferedReader, hdr); err != nil {
+		return errFormat
+	}
+	h, err := unmarshalHeader(hdr)
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(passphrase, h)
+	if err != nil {
+		return err
+	}
+
+	maxSealed := h.chunkSize + uint32(aead.Overhead())
+	sealed := make([]byte, maxSealed)
+	var plain []byte
+	for i := uint32(0); ; i++ {
+		var length [4]byte
+		if _, err := io.ReadFull(bufferedReader, length[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return errTruncated // the final chunk was never seen
+			}
+			return err
+		}
+		n := binary.BigEndian.Uint32(length[:])
+		if n < uint32(aead.Overhead()) || n > maxSealed {
+			return errAuth
+		}
+		if _, err := io.ReadFull(bufferedReader, sealed[:n]); err != nil {
+			return errTruncated
+		}
+
+		// trying the chunk as a normal one, then as the final one
+		final := false
+		plain, err = aead.Open(plain[:0], chunkNonce(h, i, false), sealed[:n], hdr)
+		if err != nil {
+			plain, err = aead.Open(plain[:0], chunkNonce(h, i, true), sealed[:n], hdr)
+			if err != nil {
+				return errAuth
+			}
+			final = true
+		}
+		if _, err := w.Write(plain); err != nil {
+			return err
+		}
+		if final {
+			if _, err := bufferedReader.Peek(1); err != io.EOF {
+				return errTrailing
+			}
+			return nil
+		}
+	}
+}
+
+// declaring a function that decrypts a file to a temporary file and renames it only if it's all valid,
+// so a tampered file never leaves partial plaintext at the destination.
+func decryptFile(src, dst, passphrase string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".decrypt-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // does nothing after a successful rename
+
+	bufferedWriter := bufio.NewWriter(tmp)
+	err = decrypt(bufferedWriter, in, passphrase)
+	if err == nil {
+		err = bufferedWriter.Flush()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// declaring a function that encrypts a file to a temporary file and renames it only if it's all written:
+// an incomplete encrypted file is never mistaken for a backup, an existing dst is kept after an error
+// and src can be dst (the file is replaced by its encrypted version).
+func encryptFile(src, dst, passphrase string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".encrypt-*") // created with mode 0600
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // does nothing after a successful rename
+
+	bufferedWriter := bufio.NewWriter(tmp)
+	err = encrypt(bufferedWriter, in, passphrase)
+	if err == nil {
+		err = bufferedWriter.Flush()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+var errPassphraseMismatch = errors.New("the passphrases don't match")
+
+// a helper function that returns the passphrase from the environment or asks for it.
+// With confirm (when encrypting), it's asked twice: a typo would make the file impossible to decrypt.
+func readPassphrase(confirm bool) (string, error) {
+	if p := os.Getenv("ENCRYPT_PASSPHRASE"); p != "" {
+		return p, nil
+	}
+	// one scanner for both lines: a second scanner would miss the bytes buffered by the first one
+	scanner := bufio.NewScanner(os.Stdin)
+	fmt.Fprint(os.Stderr, "Passphrase: ")
+	scanner.Scan()
+	passphrase := scanner.Text()
+	if confirm {
+		fmt.Fprint(os.Stderr, "Repeat passphrase: ")
+		scanner.Scan()
+		if scanner.Text() != passphrase {
+			return "", errPassphraseMismatch
+		}
+	}
+	return passphrase, scanner.Err()
+}
+
+func demo() {
+	dir, err := os.MkdirTemp("", "encryption")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := func(name string) string { return filepath.Join(dir, name) }
+	const pass = "correct horse battery staple"
+
+	// a 200 KB file: 4 chunks of 64 KB
+	original := bytes.Repeat([]byte("I learn Golang! 传\n"), 10000)
+	os.WriteFile(p("plain.txt"), original, 0644)
+
+	if err := encryptFile(p("plain.txt"), p("plain.enc"), pass); err != nil {
+		log.Fatal(err)
+	}
+	enc, _ := os.ReadFile(p("plain.enc"))
+	fmt.Println("Plaintext:", len(original), "bytes, encrypted:", len(enc), "bytes")
+	// => Plaintext: 200000 bytes, encrypted: 200117 bytes (header + 4 * (length + tag))
+
+	err = decryptFile(p("plain.enc"), p("decrypted.txt"), pass)
+	decrypted, _ := os.ReadFile(p("decrypted.txt"))
+	fmt.Println("Decrypted:", err, bytes.Equal(original, decrypted)) // => Decrypted: <nil> true
+
+	// ATTACKS
+	chunk := 4 + defaultChunkSize + 16 // the size of a full chunk in the file
+	tampered := map[string][]byte{}
+
+	flipped := bytes.Clone(enc)
+	flipped[headerSize+100] ^= 1
+	tampered["a flipped bit"] = flipped
+
+	tampered["a truncated file"] = enc[:headerSize+2*chunk] // the last 2 chunks are cut
+
+	swapped := bytes.Clone(enc[:headerSize])
+	swapped = append(swapped, enc[headerSize+chunk:headerSize+2*chunk]...) // chunk 1
+	swapped = append(swapped, enc[headerSize:headerSize+chunk]...)         // chunk 0
+	swapped = append(swapped, enc[headerSize+2*chunk:]...)
+	tampered["reordered chunks"] = swapped
+
+	headerChanged := bytes.Clone(enc)
+	headerChanged[len(magic)+2+3]-- // fewer PBKDF2 iterations
+	tampered["a changed header"] = headerChanged
+
+	slowHeader := bytes.Clone(enc)
+	binary.BigEndian.PutUint32(slowHeader[len(magic)+2:], ^uint32(0)) // 4 billion iterations
+	tampered["huge iterations"] = slowHeader
+
+	for _, name := range []string{"a flipped bit", "a truncated file", "reordered chunks", "a changed header", "huge iterations"} {
+		os.WriteFile(p("tampered.enc"), tampered[name], 0644)
+		err := decryptFile(p("tampered.enc"), p("tampered.txt"), pass)
+		fmt.Printf("%-17s %v\n", name+":", err)
+	}
+	// => a flipped bit:    wrong passphrase or corrupted file
+	// => a truncated file: file is truncated
+	// => reordered chunks: wrong passphrase or corrupted file
+	// => a changed header: wrong passphrase or corrupted file
+	// => huge iterations:  not an encrypted file or unsupported version
+
+	err = decryptFile(p("plain.enc"), p("wrong.txt"), "wrong passphrase")
+	fmt.Println("Wrong passphrase:", err) // => Wrong passphrase: wrong passphrase or corrupted file
+
+	_, err = os.Stat(p("tampered.txt"))
+	fmt.Println("Partial plaintext left:", !os.IsNotExist(err)) // => Partial plaintext left: false
+
+	// A READ ERROR WHILE ENCRYPTING: a directory can be opened but not read
+	// the existing dir.enc is not changed
+	os.Mkdir(p("dir"), 0755)
+	os.WriteFile(p("dir.enc"), []byte("an older backup"), 0600)
+	err = encryptFile(p("dir"), p("dir.enc"), pass)
+	old, _ := os.ReadFile(p("dir.enc"))
+	fmt.Printf("%s %q\n", strings.ReplaceAll(err.Error(), dir, "..."), old)
+	// => read .../dir: is a directory "an older backup"
+
+	// ENCRYPTING A FILE IN PLACE: the plaintext is read before it's replaced
+	if err := encryptFile(p("decrypted.txt"), p("decrypted.txt"), pass); err != nil {
+		log.Fatal(err)
+	}
+	err = decryptFile(p("decrypted.txt"), p("again.txt"), pass)
+	again, _ := os.ReadFile(p("again.txt"))
+	fmt.Println("In place:", err, bytes.Equal(original, again)) // => In place: <nil> true
+}
+
+func main() {
+	log.SetFlags(0)
+	usage := "usage: file-encryption.go encrypt|decrypt <src> <dst> | demo"
+	if len(os.Args) == 2 && os.Args[1] == "demo" {
+		demo()
+		return
+	}
+	if len(os.Args) != 4 {
+		log.Fatal(usage)
+	}
+
+	cmd := strings.ToLower(os.Args[1])
+	if cmd != "encrypt" && cmd != "decrypt" {
+		log.Fatal(usage)
+	}
+	passphrase, err := readPassphrase(cmd == "encrypt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cmd == "encrypt" {
+		err = encryptFile(os.Args[2], os.Args[3], passphrase)
+	} else {
+		err = decryptFile(os.Args[2], os.Args[3], passphrase)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
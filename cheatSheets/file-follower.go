@@ -0,0 +1,322 @@
+/////////////////////////////////
+// Following a Growing File (like `tail -f`)
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+// It uses syscall.Stat_t to read the inode of a file, so it's Linux (Unix) only.
+// Execute: go run file-follower.go
+// Execute: go test -v file-follower.go file-follower_test.go
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"syscall"
+	"time"
+)
+
+// declaring a struct type that follows a file and streams the appended lines
+type follower struct {
+	path     string        // the path of the followed file
+	interval time.Duration // how often the file is checked for new data
+
+	file   *os.File
+	reader *bufio.Reader
+	inode  uint64 // the inode of the opened file, it changes when the file is rotated
+	offset int64  // how many bytes were read from the opened file
+	head   []byte // the first bytes read from the opened file, they change when it's truncated and written again
+}
+
+// how many bytes at the start of the file are compared to detect a truncation
+const headSize = 64
+
+// declaring a function that opens the file and returns a follower
+// if fromStart is false the follower starts at the end of the file, like `tail -f` does.
+func newFollower(path string, fromStart bool) (*follower, error) {
+	f := &follower{path: path, interval: time.Second / 10}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	if !fromStart {
+		offset, err := f.file.Seek(0, io.SeekEnd)
+		if err != nil {
+			f.file.Close()
+			return nil, err
+		}
+		f.offset = offset
+		// remembering the first bytes, even if they are not sent
+		f.head = make([]byte, min(offset, headSize))
+		if _, err := f.file.ReadAt(f.head, 0); err != nil {
+			f.file.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// the inode identifies the file on disk, the file name doesn't.
+func inodeOf(fileInfo os.FileInfo) uint64 {
+	if st, ok := fileInfo.Sys().(*syscall.Stat_t); ok {
+		return st.Ino
+	}
+	return 0
+}
+
+// method that (re)opens the file from the beginning
+func (f *follower) open() error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.file = file
+	f.reader = bufio.NewReader(file)
+	f.inode = inodeOf(fileInfo)
+	f.offset = 0
+	f.head = nil
+	return nil
+}
+
+// method that reports if the file was truncated since the last read.
+// A file truncated and quickly filled again past the offset is not smaller than before,
+// but its first bytes are not the ones we've read.
+func (f *follower) truncated(fileInfo os.FileInfo) (bool, error) {
+	if fileInfo.Size() < f.offset {
+		return true, nil
+	}
+	if len(f.head) == 0 {
+		return false, nil
+	}
+	// the file can be truncated after Stat(): a short read (io.EOF) is a truncation too
+	head := make([]byte, len(f.head))
+	n, err := f.file.ReadAt(head, 0)
+	if err == io.EOF || n < len(head) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(head, f.head), nil
+}
+
+// method that checks if the file was truncated or rotated since the last read
+func (f *follower) check(send func(string) bool) error {
+	// checking the opened file: if it's smaller than what we've read or starts differently, it was truncated.
+	fileInfo, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+	truncated, err := f.truncated(fileInfo)
+	if err != nil {
+		return err
+	}
+	if truncated {
+		log.Printf("%s: file truncated\n", f.path)
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		f.reader.Reset(f.file)
+		f.offset = 0
+		f.head = nil
+		return nil
+	}
+
+	// checking the path: if it points to another inode, the file was renamed (rotated)
+	// and a new file was created in its place.
+	fileInfo, err = os.Stat(f.path)
+	if os.IsNotExist(err) {
+		return nil // the new file doesn't exist yet, keep waiting
+	}
+	if err != nil {
+		return err
+	}
+	if inodeOf(fileInfo) != f.inode {
+		// draining what was appended to the old file before it was rotated,
+		// including the last line without a \n: nobody will complete it now
+		if err := f.drain(send); err != nil {
+			return err
+		}
+		rest, err := io.ReadAll(f.reader)
+		if err != nil {
+			return err
+		}
+		if len(rest) > 0 && !send(string(rest)) {
+			return nil
+		}
+		log.Printf("%s: file rotated, reopening\n", f.path)
+		return f.open()
+	}
+	return nil
+}
+
+// method that reads all the complete lines that are available and sends them into the channel.
+// a line without a trailing \n is incomplete (the writer is still writing it) so it's read again later.
+func (f *follower) drain(send func(string) bool) error {
+	for {
+		line, err := f.reader.ReadString('\n')
+		if err == io.EOF {
+			// moving back to the start of the incomplete line
+			if len(line) > 0 {
+				if _, err := f.file.Seek(f.offset, io.SeekStart); err != nil {
+					return err
+				}
+				f.reader.Reset(f.file)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		f.offset += int64(len(line))
+		if n := min(headSize-len(f.head), len(line)); n > 0 {
+			f.head = append(f.head, line[:n]...)
+		}
+		if !send(line[:len(line)-1]) {
+			return nil
+		}
+	}
+}
+
+// method that streams the lines on a receive-only channel until the context is cancelled
+// the lines channel is closed when the follower stops and the error (if any) is sent on the errc channel.
+func (f *follower) lines(ctx context.Context) (<-chan string, <-chan error) {
+	out := make(chan string)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(out)
+		defer close(errc)
+		defer f.file.Close()
+
+		// sending a line or giving up if the context is cancelled
+		send := func(line string) bool {
+			select {
+			case out <- line:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := f.drain(send); err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := f.check(send); err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+
+	return out, errc
+}
+
+// a helper function that appends text to the file, like a logger would do
+func appendTo(path, text string) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(text); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func main() {
+	// working in a temporary directory so that we don't touch the current working directory
+	dir, err := os.MkdirTemp("", "follower")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := dir + "/app.log"
+	appendTo(path, "this line was written before following started\n")
+
+	// following the file from its end
+	f, err := newFollower(path, false)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the context is cancelled after 2 seconds, this stops the follower
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	lines, errc := f.lines(ctx)
+
+	// a goroutine that simulates a program that writes to the log file
+	go func() {
+		appendTo(path, "line 1\nline 2\n")
+		time.Sleep(time.Second / 4)
+
+		// TRUNCATING THE FILE (the follower starts again from the beginning)
+		if err := os.Truncate(path, 0); err != nil {
+			log.Fatal(err)
+		}
+		time.Sleep(time.Second / 4)
+		appendTo(path, "line 3 after truncation\n")
+		time.Sleep(time.Second / 4)
+
+		// TRUNCATING AND WRITING MORE THAN BEFORE before the next check: the size alone doesn't show it
+		if err := os.Truncate(path, 0); err != nil {
+			log.Fatal(err)
+		}
+		appendTo(path, "line 4 after a quick truncation and refill\n")
+		time.Sleep(time.Second / 4)
+
+		// ROTATING THE FILE (renaming it and creating a new one with the same name)
+		appendTo(path, "line 5 before rotation\nline 6 without a newline")
+		if err := os.Rename(path, path+".1"); err != nil {
+			log.Fatal(err)
+		}
+		appendTo(path, "line 7 after rotation\n")
+	}()
+
+	// receiving the lines until the channel is closed
+	for line := range lines {
+		fmt.Println("New line:", line)
+	}
+
+	// a receive from the closed errc channel returns nil if there was no error
+	if err := <-errc; err != nil {
+		log.Fatal(err)
+	}
+
+	// ** EXPECTED OUTPUT: **//
+	// New line: line 1
+	// New line: line 2
+	// 2019/10/21 16:26:16 /tmp/follower.../app.log: file truncated
+	// New line: line 3 after truncation
+	// 2019/10/21 16:26:16 /tmp/follower.../app.log: file truncated
+	// New line: line 4 after a quick truncation and refill
+	// New line: line 5 before rotation
+	// New line: line 6 without a newline
+	// 2019/10/21 16:26:16 /tmp/follower.../app.log: file rotated, reopening
+	// New line: line 7 after rotation
+}
@@ -0,0 +1,151 @@
+/////////////////////////////////
+// Tests: Following a File That Is Appended To, Truncated and Rotated
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Execute: go test -v file-follower.go file-follower_test.go
+
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// a helper function that starts a follower of a new file with some content
+func startFollower(t *testing.T, content string, fromStart bool) (string, <-chan string, <-chan error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := newFollower(path, fromStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.interval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	lines, errc := f.lines(ctx)
+	t.Cleanup(func() {
+		cancel()
+		for range lines {
+		}
+		if err := <-errc; err != nil {
+			t.Error(err)
+		}
+	})
+	return path, lines, errc
+}
+
+// a helper function that receives the next lines and compares them
+func expectLines(t *testing.T, lines <-chan string, errc <-chan error, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("the follower stopped: %v", <-errc)
+			}
+			if line != w {
+				t.Fatalf("got %q, want %q", line, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for %q", w)
+		}
+	}
+}
+
+// a helper function that writes to the file like a logger: O_APPEND, or O_TRUNC to replace it
+func writeTo(t *testing.T, path, text string, flag int) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(text); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollowAppend(t *testing.T) {
+	path, lines, errc := startFollower(t, "old line\n", false)
+	writeTo(t, path, "line 1\nline ", os.O_APPEND)
+	expectLines(t, lines, errc, "line 1")
+	time.Sleep(50 * time.Millisecond) // the incomplete line is not sent...
+	writeTo(t, path, "2\n", os.O_APPEND)
+	expectLines(t, lines, errc, "line 2") // ...until it's complete
+}
+
+func TestFollowFromStart(t *testing.T) {
+	path, lines, errc := startFollower(t, "old line\n", true)
+	writeTo(t, path, "line 1\n", os.O_APPEND)
+	expectLines(t, lines, errc, "old line", "line 1")
+}
+
+func TestFollowTruncate(t *testing.T) {
+	path, lines, errc := startFollower(t, "", false)
+	writeTo(t, path, "line 1\nline 2\n", os.O_APPEND)
+	expectLines(t, lines, errc, "line 1", "line 2")
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond) // the truncation is seen before the new line
+	writeTo(t, path, "line 3\n", os.O_APPEND)
+	expectLines(t, lines, errc, "line 3")
+}
+
+// truncated and written again past the offset before the next check: the size alone doesn't show it
+func TestFollowQuickRefill(t *testing.T) {
+	path, lines, errc := startFollower(t, "", false)
+	writeTo(t, path, "line 1\n", os.O_APPEND)
+	expectLines(t, lines, errc, "line 1")
+	writeTo(t, path, "line 2 is longer than line 1\n", os.O_TRUNC)
+	expectLines(t, lines, errc, "line 2 is longer than line 1")
+}
+
+func TestFollowRotate(t *testing.T) {
+	path, lines, errc := startFollower(t, "", false)
+	writeTo(t, path, "line 1\nline 2 without a newline", os.O_APPEND)
+	expectLines(t, lines, errc, "line 1")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	writeTo(t, path, "line 3 in the new file\n", os.O_APPEND)
+	// the last line of the rotated file is sent, nobody will complete it now
+	expectLines(t, lines, errc, "line 2 without a newline", "line 3 in the new file")
+}
+
+// the file is truncated between Stat() and ReadAt(): it's a truncation, not an error
+func TestTruncatedAfterStat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("line 1\nline 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := newFollower(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.file.Close()
+	if err := f.drain(func(string) bool { return true }); err != nil {
+		t.Fatal(err)
+	}
+	fileInfo, err := f.file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, 3); err != nil {
+		t.Fatal(err)
+	}
+	truncated, err := f.truncated(fileInfo) // fileInfo still has the old size
+	if err != nil || !truncated {
+		t.Errorf("truncated() = %v, %v, want true, <nil>", truncated, err)
+	}
+	if err == io.EOF {
+		t.Error("io.EOF would stop the follower")
+	}
+}
@@ -0,0 +1,314 @@
+/////////////////////////////////
+// Advisory File Locking (flock, fcntl and PID Lock Files)
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+// It uses Linux system calls (syscall.Flock and syscall.FcntlFlock).
+// Execute: go run file-locking.go
+// The tests start child processes that fight for the locks.
+// Execute: go test -v file-locking.go file-locking_test.go
+
+// Advisory locks only work if every process that uses the file takes the lock.
+// The kernel doesn't stop a process that ignores the lock from writing to the file.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// declaring a defined type for the lock mode
+type lockMode int
+
+const (
+	shared    lockMode = iota // many readers can hold a shared lock at the same time
+	exclusive                 // only one writer can hold an exclusive lock
+)
+
+// the error returned when a lock can't be taken without waiting
+var errLocked = errors.New("file is locked by another process")
+
+/////////////////////////////////
+// flock(2): Locks the Whole File
+/////////////////////////////////
+
+// flock locks belong to the open file description, so they are released
+// when the file is closed (or the process exits).
+func flock(file *os.File, mode lockMode, try bool) error {
+	how := syscall.LOCK_SH
+	if mode == exclusive {
+		how = syscall.LOCK_EX
+	}
+	if try {
+		how |= syscall.LOCK_NB // non-blocking: fail instead of waiting
+	}
+	for {
+		err := syscall.Flock(int(file.Fd()), how)
+		if err == syscall.EINTR {
+			continue // interrupted by a signal, try again
+		}
+		if err == syscall.EWOULDBLOCK {
+			return errLocked
+		}
+		return err
+	}
+}
+
+func funlock(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
+
+/////////////////////////////////
+// fcntl(2): Locks a Range of Bytes (POSIX record locks)
+/////////////////////////////////
+
+// fcntl locks belong to the process, they are released when the process closes ANY
+// file descriptor of that file. A length of 0 means "until the end of the file".
+func fcntlLock(file *os.File, mode lockMode, try bool, start, length int64) error {
+	lk := syscall.Flock_t{
+		Type:   syscall.F_RDLCK,
+		Whence: 0, // io.SeekStart
+		Start:  start,
+		Len:    length,
+	}
+	if mode == exclusive {
+		lk.Type = syscall.F_WRLCK
+	}
+	cmd := syscall.F_SETLKW // wait for the lock
+	if try {
+		cmd = syscall.F_SETLK
+	}
+	for {
+		err := syscall.FcntlFlock(file.Fd(), cmd, &lk)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == syscall.EAGAIN || err == syscall.EACCES {
+			return errLocked
+		}
+		return err
+	}
+}
+
+func fcntlUnlock(file *os.File, start, length int64) error {
+	lk := syscall.Flock_t{Type: syscall.F_UNLCK, Start: start, Len: length}
+	return syscall.FcntlFlock(file.Fd(), syscall.F_SETLK, &lk)
+}
+
+/////////////////////////////////
+// Locking with a Timeout
+/////////////////////////////////
+
+// the system calls can't be cancelled, so we retry a non-blocking lock until the deadline.
+func flockTimeout(file *os.File, mode lockMode, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	wait := time.Millisecond
+	for {
+		err := flock(file, mode, true)
+		if err != errLocked {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout after %v: %w", timeout, err)
+		}
+		time.Sleep(wait)
+		if wait < 100*time.Millisecond {
+			wait *= 2 // backing off
+		}
+	}
+}
+
+/////////////////////////////////
+// Lock Files with PID Staleness Detection
+/////////////////////////////////
+
+// A lock file (like app.pid or .lock) holds the PID of the process that owns the lock.
+// Checking the PID and then removing a stale file is a race: two processes can both see the dead PID,
+// the first one removes the file and creates its own lock, then the second one removes that live lock.
+// So the lock file is also flocked: the kernel releases a flock when its process dies,
+// so a crashed owner never blocks the others, and taking over a stale file is atomic.
+
+// declaring a function that checks if a process is alive
+// signal 0 doesn't send anything, it only checks that the process exists.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false // kill(0, 0) and kill(-1, 0) check process groups, not a process
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM // EPERM: it exists but belongs to another user
+}
+
+// declaring a struct type for a lock file held by this process
+type lockFile struct {
+	path string
+	file *os.File // kept open: closing it releases the flock
+}
+
+// declaring a function that takes the lock file or returns errLocked
+func acquireLockFile(path string) (*lockFile, error) {
+	for {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		data, _ := os.ReadFile(path)
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err := flock(file, exclusive, true); err != nil {
+			file.Close()
+			if err == errLocked {
+				return nil, fmt.Errorf("%w (pid %d)", errLocked, pid)
+			}
+			return nil, err
+		}
+
+		// the owner may have removed the file between our open and our flock:
+		// then we hold the lock of a file that is not at path anymore, trying again
+		fileInfo, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		pathInfo, err := os.Stat(path)
+		if os.IsNotExist(err) || (err == nil && !os.SameFile(fileInfo, pathInfo)) {
+			file.Close()
+			continue
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		// reading the PID again under the flock: it can't change now
+		data, err = os.ReadFile(path)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		pid, err = strconv.Atoi(strings.TrimSpace(string(data)))
+		if err == nil && pid != os.Getpid() {
+			// a process that writes the file without flock (an older version of the program)
+			if processAlive(pid) {
+				file.Close()
+				return nil, fmt.Errorf("%w (pid %d)", errLocked, pid)
+			}
+			log.Printf("taking over stale lock file %s (pid %d)\n", path, pid)
+		}
+
+		if err := file.Truncate(0); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if _, err := file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &lockFile{path: path, file: file}, nil
+	}
+}
+
+// method that removes the lock file, then releases the flock.
+// In this order a process waiting for the flock finds that the file was removed and opens the new one.
+func (l *lockFile) release() error {
+	err := os.Remove(l.path)
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+/////////////////////////////////
+// Helper Process: Appending Lines Under an Exclusive Lock
+/////////////////////////////////
+
+// the tests start the test binary again as child processes that run this function (see file-locking_test.go).
+// Every child appends lines, writing each line in 2 pieces to make interleaving easy to spot.
+func child(path, id string, lines int) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	bufferedWriter := bufio.NewWriterSize(file, 16)
+	for i := 0; i < lines; i++ {
+		if err := flock(file, exclusive, false); err != nil {
+			return err
+		}
+		if _, err := bufferedWriter.WriteString("child " + id + " "); err != nil {
+			return err
+		}
+		if err := bufferedWriter.Flush(); err != nil {
+			return err
+		}
+		time.Sleep(time.Millisecond)
+		if _, err := bufferedWriter.WriteString("line " + strconv.Itoa(i) + "\n"); err != nil {
+			return err
+		}
+		if err := bufferedWriter.Flush(); err != nil {
+			return err
+		}
+		if err := funlock(file); err != nil {
+			return err
+		}
+	}
+	return file.Close()
+}
+
+func main() {
+	dir, err := os.MkdirTemp("", "locks")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := dir + "/my_file.txt"
+	if err := os.WriteFile(path, []byte("some data\n"), 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	// SHARED, EXCLUSIVE AND TRY-LOCK MODES
+	// flock locks are per open file, so two os.Open() calls in the same process conflict like two processes.
+	// (the locks between real processes are tested by file-locking_test.go)
+	f1, _ := os.Open(path)
+	f2, _ := os.Open(path)
+	defer f1.Close()
+	defer f2.Close()
+
+	fmt.Println(flock(f1, shared, true)) // => <nil>
+	fmt.Println(flock(f2, shared, true)) // => <nil> (many shared locks are allowed)
+	funlock(f2)
+
+	fmt.Println(flock(f2, exclusive, true))                       // => file is locked by another process
+	fmt.Println(flockTimeout(f2, exclusive, 50*time.Millisecond)) // => timeout after 50ms: file is locked by another process
+	funlock(f1)
+	fmt.Println(flockTimeout(f2, exclusive, 50*time.Millisecond)) // => <nil>
+	funlock(f2)
+
+	// BYTE RANGE LOCKS WITH fcntl
+	rw, _ := os.OpenFile(path, os.O_RDWR, 0644)
+	defer rw.Close()
+	fmt.Println(fcntlLock(rw, exclusive, true, 0, 100)) // => <nil> (locking the first 100 bytes)
+	fmt.Println(fcntlUnlock(rw, 0, 100))                // => <nil>
+
+	// LOCK FILES
+	lockPath := dir + "/app.lock"
+	lock, err := acquireLockFile(lockPath)
+	fmt.Println(err) // => <nil>
+	_, err = acquireLockFile(lockPath)
+	fmt.Println(err) // => file is locked by another process (pid 12345)
+	lock.release()
+
+	// simulating a crashed process: the pid in the lock file doesn't exist anymore and nobody holds the flock
+	os.WriteFile(lockPath, []byte("999999999\n"), 0644)
+	lock, err = acquireLockFile(lockPath) // => taking over stale lock file .../app.lock (pid 999999999)
+	fmt.Println(err)                      // => <nil>
+	lock.release()
+}
@@ -0,0 +1,179 @@
+/////////////////////////////////
+// Tests: Locks Between Processes
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Execute: go test -v file-locking.go file-locking_test.go
+
+// A test can't fork itself like C does: it starts the test binary again (os.Args[0]) with -test.run
+// selecting TestHelperProcess and an environment variable that tells it what to do.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// the environment variable that turns the test binary into a helper process
+const helperEnv = "FILE_LOCKING_HELPER"
+
+// declaring a function that starts the test binary as a helper process
+func startHelper(t *testing.T, args ...string) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), helperEnv+"=1")
+	cmd.Args = append(cmd.Args, append([]string{"--"}, args...)...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+// not a real test: it's the code of the helper processes, it does nothing under a normal `go test`
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv(helperEnv) != "1" {
+		t.Skip("only runs as a helper process")
+	}
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	args = args[1:]
+
+	var err error
+	switch args[0] {
+	case "append": // append <file> <id>: appending lines under flock
+		err = child(args[1], args[2], 50)
+	case "lockfile": // lockfile <lock> <marker>: holding the lock file for a moment
+		err = holdLockFile(args[1], args[2])
+	default:
+		err = fmt.Errorf("unknown helper command %q", args[0])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "helper:", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// declaring a function that takes the lock file and, while it holds it, creates a marker file with O_EXCL.
+// If two processes held the lock at the same time, the second O_EXCL would fail.
+func holdLockFile(lockPath, marker string) error {
+	lock, err := acquireLockFile(lockPath)
+	for errors.Is(err, errLocked) {
+		time.Sleep(time.Millisecond)
+		lock, err = acquireLockFile(lockPath)
+	}
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(marker, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		lock.release()
+		return fmt.Errorf("two processes hold the lock: %w", err)
+	}
+	file.Close()
+	time.Sleep(5 * time.Millisecond)
+	if err := os.Remove(marker); err != nil {
+		lock.release()
+		return err
+	}
+	return lock.release()
+}
+
+// declaring a function that waits for the helper processes
+func waitHelpers(t *testing.T, cmds []*exec.Cmd) {
+	t.Helper()
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("helper %v: %v", cmd.Args[len(cmd.Args)-3:], err)
+		}
+	}
+}
+
+func TestFlockMutualExclusion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "my_file.txt")
+	var cmds []*exec.Cmd
+	for i := 1; i <= 4; i++ {
+		cmds = append(cmds, startHelper(t, "append", path, strconv.Itoa(i)))
+	}
+	waitHelpers(t, cmds)
+
+	// every line must be complete, otherwise two processes wrote at the same time
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	lines := 0
+	for scanner.Scan() {
+		lines++
+		var id, n int
+		if c, _ := fmt.Sscanf(scanner.Text(), "child %d line %d", &id, &n); c != 2 {
+			t.Errorf("interleaved line %q", scanner.Text())
+		}
+	}
+	if lines != 200 {
+		t.Errorf("got %d lines, want 200", lines)
+	}
+}
+
+func TestLockFileStaleTakeover(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, "app.lock")
+	marker := filepath.Join(dir, "holder")
+
+	// a crashed owner left the lock file behind: all the helpers see the dead PID at the same time
+	if err := os.WriteFile(lockPath, []byte("999999999\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var cmds []*exec.Cmd
+	for i := 0; i < 8; i++ {
+		cmds = append(cmds, startHelper(t, "lockfile", lockPath, marker))
+	}
+	waitHelpers(t, cmds)
+}
+
+func TestLockFileHeldByLiveProcess(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "app.lock")
+	lock, err := acquireLockFile(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.release()
+
+	// the goroutines of this process open the file again: flock conflicts like between processes
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := acquireLockFile(lockPath); err == nil {
+				t.Error("lock acquired twice")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestProcessAlive(t *testing.T) {
+	for _, pid := range []int{0, -1} {
+		if processAlive(pid) {
+			t.Errorf("processAlive(%d) = true, want false", pid)
+		}
+	}
+	if !processAlive(os.Getpid()) {
+		t.Error("processAlive(os.Getpid()) = false, want true")
+	}
+}
@@ -0,0 +1,491 @@
+/////////////////////////////////
+// Detecting File Types by Magic Bytes
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+
+// Execute:
+// go run file-type.go filetype [-mime] <path> [<path> ...]
+// go run file-type.go demo
+
+// The extension of a file name can be anything: report.pdf may be a ZIP file.
+// Most formats start with a fixed sequence of "magic bytes", so reading the first bytes of the file
+// with io.ReadFull() is enough to identify it (like the Unix `file` command).
+// Some formats have no magic (text) or weak magic (JPEG is only 3 bytes), so every match has a confidence.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// the number of bytes read from the start of every file
+const headerSize = 8192
+
+// confidence levels of a match
+const (
+	certain = 1.0 // a long magic and a valid structure
+	high    = 0.9 // a short magic
+	medium  = 0.7 // a heuristic, like text detection
+	low     = 0.5
+)
+
+/////////////////////////////////
+// The Signature Database
+/////////////////////////////////
+
+// declaring a function type that checks the header of a file.
+// It returns 0 if the header doesn't match, else the confidence and an optional detail (like the image size).
+type matcher func(header []byte) (confidence float64, detail string)
+
+// declaring a struct type for a file format
+type signature struct {
+	name  string
+	mime  string
+	match matcher
+}
+
+// declaring a struct type for the result of a detection
+type fileType struct {
+	Name       string
+	MIME       string
+	Confidence float64
+	Detail     string
+}
+
+var signatures []signature
+
+// declaring a function that adds a format to the database
+func register(name, mime string, match matcher) {
+	signatures = append(signatures, signature{name, mime, match})
+}
+
+// declaring a function that adds a format identified by fixed bytes at an offset
+func registerMagic(name, mime string, offset int, magic string, confidence float64) {
+	register(name, mime, func(h []byte) (float64, string) {
+		if hasAt(h, offset, magic) {
+			return confidence, ""
+		}
+		return 0, ""
+	})
+}
+
+// a helper function that reports if the header contains s at offset
+func hasAt(h []byte, offset int, s string) bool {
+	return len(h) >= offset+len(s) && string(h[offset:offset+len(s)]) == s
+}
+
+// declaring a function that returns the best match for a header
+// The highest confidence wins, if two formats have the same confidence the one registered first wins.
+func detect(h []byte) fileType {
+	if len(h) == 0 {
+		return fileType{"empty", "application/x-empty", certain, ""}
+	}
+	best := fileType{"data", "application/octet-stream", 0, ""}
+	for _, s := range signatures {
+		if c, detail := s.match(h); c > best.Confidence {
+			best = fileType{s.name, s.mime, c, detail}
+		}
+	}
+	return best
+}
+
+// declaring a function that reads the header of a file and detects its type
+func detectFile(path string) (fileType, error) {
+	// os.Lstat() doesn't open the file: opening a named pipe would block until a writer shows up
+	fileInfo, err := os.Lstat(path)
+	if err != nil {
+		return fileType{}, err
+	}
+	switch mode := fileInfo.Mode(); {
+	case mode.IsDir():
+		return fileType{"directory", "inode/directory", certain, ""}, nil
+	case mode&os.ModeSymlink != 0:
+		target, _ := os.Readlink(path)
+		return fileType{"symbolic link", "inode/symlink", certain, "to " + target}, nil
+	case mode&os.ModeNamedPipe != 0:
+		return fileType{"named pipe", "inode/fifo", certain, ""}, nil
+	case mode&os.ModeSocket != 0:
+		return fileType{"socket", "inode/socket", certain, ""}, nil
+	case mode&os.ModeCharDevice != 0: // /dev/null, /dev/tty
+		return fileType{"character device", "inode/chardevice", certain, ""}, nil
+	case mode&os.ModeDevice != 0: // /dev/sda
+		return fileType{"block device", "inode/blockdevice", certain, ""}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fileType{}, err
+	}
+	defer file.Close()
+	header := make([]byte, headerSize)
+	// a file smaller than the header is not an error here
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return fileType{}, err
+	}
+	return detect(header[:n]), nil
+}
+
+/////////////////////////////////
+// Built-in Formats
+/////////////////////////////////
+
+func init() {
+	register("ELF", "application/x-executable", matchELF)
+	register("PNG image", "image/png", func(h []byte) (float64, string) {
+		if !hasAt(h, 0, "\x89PNG\r\n\x1a\n") {
+			return 0, ""
+		}
+		if hasAt(h, 12, "IHDR") && len(h) >= 24 { // the first chunk holds the size
+			return certain, fmt.Sprintf("%d x %d", binary.BigEndian.Uint32(h[16:]), binary.BigEndian.Uint32(h[20:]))
+		}
+		return high, ""
+	})
+	registerMagic("JPEG image", "image/jpeg", 0, "\xff\xd8\xff", high)
+	register("GIF image", "image/gif", func(h []byte) (float64, string) {
+		if (hasAt(h, 0, "GIF87a") || hasAt(h, 0, "GIF89a")) && len(h) >= 10 {
+			return certain, fmt.Sprintf("%d x %d", binary.LittleEndian.Uint16(h[6:]), binary.LittleEndian.Uint16(h[8:]))
+		}
+		return 0, ""
+	})
+	register("PDF document", "application/pdf", func(h []byte) (float64, string) {
+		if hasAt(h, 0, "%PDF-") && len(h) >= 8 {
+			return certain, "version " + string(h[5:8])
+		}
+		// the specification allows junk before the magic, readers look for it in the first 1024 bytes
+		if bytes.Contains(h[:min(len(h), 1024)], []byte("%PDF-")) {
+			return low, ""
+		}
+		return 0, ""
+	})
+	registerMagic("Zip archive", "application/zip", 0, "PK\x03\x04", high)
+	registerMagic("Zip archive (empty)", "application/zip", 0, "PK\x05\x06", high)
+	registerMagic("gzip compressed data", "application/gzip", 0, "\x1f\x8b\x08", high)
+	register("tar archive", "application/x-tar", matchTar)
+	registerMagic("SQLite 3 database", "application/vnd.sqlite3", 0, "SQLite format 3\x00", certain)
+	register("Go object file", "application/x-go-object", matchGoObject)
+	registerMagic("ar archive", "application/x-archive", 0, "!<arch>\n", high)
+	register("Unicode text, UTF-8", "text/plain; charset=utf-8", matchUTF8)
+	register("Unicode text, UTF-16", "text/plain; charset=utf-16", matchUTF16)
+}
+
+// declaring a function that matches ELF executables, libraries and object files
+func matchELF(h []byte) (float64, string) {
+	if !hasAt(h, 0, "\x7fELF") || len(h) < 20 {
+		return 0, ""
+	}
+	class := map[byte]string{1: "32-bit", 2: "64-bit"}[h[4]]
+	var order binary.ByteOrder = binary.LittleEndian
+	if h[5] == 2 {
+		order = binary.BigEndian
+	}
+	if class == "" || (h[5] != 1 && h[5] != 2) {
+		return high, "" // the magic is there, but the identification bytes are invalid
+	}
+	kind := map[uint16]string{1: "relocatable", 2: "executable", 3: "shared object", 4: "core file"}[order.Uint16(h[16:])]
+	machine := map[uint16]string{3: "x86", 40: "ARM", 62: "x86-64", 183: "ARM aarch64", 243: "RISC-V"}[order.Uint16(h[18:])]
+	return certain, strings.Join(strings.Fields(class+" "+kind+" "+machine), " ")
+}
+
+// declaring a function that matches tar archives
+// Modern archives have "ustar" at offset 257, old ones are recognized only by the checksum of the header.
+func matchTar(h []byte) (float64, string) {
+	if len(h) < 512 {
+		return 0, ""
+	}
+	magic := hasAt(h, 257, "ustar")
+	stored, err := strconv.ParseUint(strings.Trim(string(h[148:156]), " \x00"), 8, 64)
+	checksumOK := false
+	if err == nil {
+		// the checksum is the sum of the 512 header bytes, with the checksum field counted as spaces
+		var sum uint64
+		for i, b := range h[:512] {
+			if 148 <= i && i < 156 {
+				b = ' '
+			}
+			sum += uint64(b)
+		}
+		checksumOK = sum == stored
+	}
+	switch {
+	case magic && checksumOK:
+		return certain, ""
+	case magic:
+		return high, "bad header checksum"
+	case checksumOK:
+		return medium, "pre-POSIX format"
+	}
+	return 0, ""
+}
+
+// declaring a function that matches the output of the Go compiler: an ar archive whose first member is
+// __.PKGDEF (the export data), which starts with "go object <os> <arch> <version>"
+func matchGoObject(h []byte) (float64, string) {
+	const member = 8 + 60 // the "!<arch>\n" magic and the 60 bytes of the member header
+	var line []byte
+	switch {
+	case hasAt(h, 0, "!<arch>\n") && hasAt(h, 8, "__.PKGDEF") && hasAt(h, member, "go object "):
+		line = h[member:]
+	case hasAt(h, 0, "go object "): // old versions of the compiler wrote it without the archive
+		line = h
+	default:
+		return 0, ""
+	}
+	line, _, _ = bytes.Cut(line, []byte("\n"))
+	fields := strings.Fields(string(line))
+	if len(fields) < 5 {
+		return high, ""
+	}
+	return certain, strings.Join(fields[2:5], " ") // linux amd64 go1.27.1
+}
+
+// a helper function that reports if a rune is a control character that text files don't use
+func isBinaryControl(r rune) bool {
+	return r < 0x20 && r != '\t' && r != '\n' && r != '\r' && r != '\f' && r != '\v' && r != 0x1b
+}
+
+// declaring a function that matches UTF-8 (and ASCII) text
+func matchUTF8(h []byte) (float64, string) {
+	confidence := medium
+	if bytes.HasPrefix(h, []byte("\xef\xbb\xbf")) {
+		confidence, h = certain, h[3:]
+	}
+	// the header may end in the middle of a multi-byte character
+	if len(h) == headerSize {
+		for i := 1; i <= 3 && i <= len(h); i++ {
+			if utf8.RuneStart(h[len(h)-i]) {
+				if !utf8.FullRune(h[len(h)-i:]) {
+					h = h[:len(h)-i]
+				}
+				break
+			}
+		}
+	}
+	if !utf8.Valid(h) {
+		return 0, ""
+	}
+	ascii := true
+	for _, r := range string(h) {
+		if isBinaryControl(r) {
+			return 0, ""
+		}
+		if r >= utf8.RuneSelf {
+			ascii = false
+		}
+	}
+	if ascii {
+		return confidence, "ASCII only"
+	}
+	return confidence, ""
+}
+
+// declaring a function that matches UTF-16 text, with or without a byte order mark
+func matchUTF16(h []byte) (float64, string) {
+	switch {
+	case bytes.HasPrefix(h, []byte("\xff\xfe")):
+		return high, "little-endian, with BOM"
+	case bytes.HasPrefix(h, []byte("\xfe\xff")):
+		return high, "big-endian, with BOM"
+	}
+	// without a BOM: text in Latin scripts has a zero in every other byte (the high byte of the code unit)
+	pairs := len(h) / 2
+	if pairs < 4 {
+		return 0, ""
+	}
+	var even, odd int
+	for i := 0; i+1 < len(h); i += 2 {
+		if h[i] == 0 {
+			even++
+		}
+		if h[i+1] == 0 {
+			odd++
+		}
+	}
+	switch {
+	case odd*10 >= pairs*4 && even*20 < pairs:
+		return low, "little-endian, without BOM"
+	case even*10 >= pairs*4 && odd*20 < pairs:
+		return low, "big-endian, without BOM"
+	}
+	return 0, ""
+}
+
+/////////////////////////////////
+// Demo
+/////////////////////////////////
+
+func demo() {
+	dir, err := os.MkdirTemp("", "filetype")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			log.Fatal(err)
+		}
+		return path
+	}
+	var paths []string
+
+	// images encoded by the standard library
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	var b bytes.Buffer
+	png.Encode(&b, img)
+	paths = append(paths, write("image.png", b.Bytes()))
+	b.Reset()
+	gif.Encode(&b, img, nil)
+	paths = append(paths, write("image.gif", b.Bytes()))
+	b.Reset()
+	jpeg.Encode(&b, img, nil)
+	paths = append(paths, write("photo.dat", b.Bytes())) // the extension doesn't matter
+
+	// archives
+	b.Reset()
+	zw := zip.NewWriter(&b)
+	w, _ := zw.Create("a.txt")
+	w.Write([]byte("hello"))
+	zw.Close()
+	paths = append(paths, write("report.pdf", b.Bytes())) // a ZIP file named .pdf
+
+	b.Reset()
+	gw := gzip.NewWriter(&b)
+	gw.Write([]byte("hello"))
+	gw.Close()
+	paths = append(paths, write("a.txt.gz", b.Bytes()))
+
+	b.Reset()
+	tw := tar.NewWriter(&b)
+	tw.WriteHeader(&tar.Header{Name: "a.txt", Mode: 0644, Size: 5})
+	tw.Write([]byte("hello"))
+	tw.Close()
+	paths = append(paths, write("backup.tar", b.Bytes()))
+
+	// headers written by hand
+	paths = append(paths, write("doc.pdf", []byte("%PDF-1.7\n%âãÏÓ\n1 0 obj\n")))
+	paths = append(paths, write("app.db", append([]byte("SQLite format 3\x00"), make([]byte, 84)...)))
+	goObject := "!<arch>\n" + fmt.Sprintf("%-16s%-12s%-6s%-6s%-8s%-10s`\n", "__.PKGDEF", "0", "0", "0", "644", "40") +
+		"go object linux amd64 go1.27.1 X:none\n"
+	paths = append(paths, write("x.o", []byte(goObject)))
+
+	// the executable of this program is an ELF file on Linux
+	exe, _ := os.Executable()
+	paths = append(paths, exe)
+
+	// text
+	paths = append(paths, write("notes.txt", []byte("I learn Golang!\n")))
+	paths = append(paths, write("romanian.txt", []byte("Bună ziua, ţară!\n")))
+	paths = append(paths, write("utf16.txt", []byte("\xff\xfeh\x00i\x00!\x00\n\x00")))
+	paths = append(paths, write("utf16-nobom.txt", []byte("G\x00o\x00l\x00a\x00n\x00g\x00\n\x00")))
+	paths = append(paths, write("random.bin", []byte{0x00, 0x13, 0x9a, 0xff, 0x01, 0x02, 0x7f}))
+	paths = append(paths, write("empty", nil))
+	paths = append(paths, dir)
+
+	for _, p := range paths {
+		printType(p, false)
+	}
+	// => image.png: PNG image, 40 x 30 (image/png, 100%)
+	// => image.gif: GIF image, 40 x 30 (image/gif, 100%)
+	// => photo.dat: JPEG image (image/jpeg, 90%)
+	// => report.pdf: Zip archive (application/zip, 90%)
+	// => a.txt.gz: gzip compressed data (application/gzip, 90%)
+	// => backup.tar: tar archive (application/x-tar, 100%)
+	// => doc.pdf: PDF document, version 1.7 (application/pdf, 100%)
+	// => app.db: SQLite 3 database (application/vnd.sqlite3, 100%)
+	// => x.o: Go object file, linux amd64 go1.27.1 (application/x-go-object, 100%)
+	// => file-type: ELF, 64-bit executable x86-64 (application/x-executable, 100%)
+	// => notes.txt: Unicode text, UTF-8, ASCII only (text/plain; charset=utf-8, 70%)
+	// => romanian.txt: Unicode text, UTF-8 (text/plain; charset=utf-8, 70%)
+	// => utf16.txt: Unicode text, UTF-16, little-endian, with BOM (text/plain; charset=utf-16, 90%)
+	// => utf16-nobom.txt: Unicode text, UTF-16, little-endian, without BOM (text/plain; charset=utf-16, 50%)
+	// => random.bin: data (application/octet-stream, 0%)
+	// => empty: empty (application/x-empty, 100%)
+	// => filetype1903613788: directory (inode/directory, 100%)
+
+	// EXTENDING THE DATABASE
+	// An EPUB book is a ZIP file whose first entry is an uncompressed file named "mimetype".
+	// It matches "Zip archive" with 90%, so the EPUB signature must be more confident to win.
+	register("EPUB document", "application/epub+zip", func(h []byte) (float64, string) {
+		if hasAt(h, 0, "PK\x03\x04") && hasAt(h, 30, "mimetypeapplication/epub+zip") {
+			return certain, ""
+		}
+		return 0, ""
+	})
+	registerMagic("WebAssembly binary", "application/wasm", 0, "\x00asm", certain)
+
+	b.Reset()
+	zw = zip.NewWriter(&b)
+	w, _ = zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	w.Write([]byte("application/epub+zip"))
+	zw.Close()
+	printType(write("book.epub", b.Bytes()), false)
+	printType(write("module.wasm", []byte("\x00asm\x01\x00\x00\x00")), true)
+	// => book.epub: EPUB document (application/epub+zip, 100%)
+	// => module.wasm: application/wasm
+}
+
+// a helper function that prints the type of a file like the `file` command
+func printType(path string, mimeOnly bool) {
+	t, err := detectFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return
+	}
+	name := filepath.Base(path)
+	if mimeOnly {
+		fmt.Printf("%s: %s\n", name, t.MIME)
+		return
+	}
+	description := t.Name
+	if t.Detail != "" {
+		description += ", " + t.Detail
+	}
+	fmt.Printf("%s: %s (%s, %.0f%%)\n", name, description, t.MIME, t.Confidence*100)
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		log.Fatal("usage: file-type.go filetype [-mime] <path>... | demo")
+	}
+
+	switch os.Args[1] {
+	case "filetype":
+		cmd := flag.NewFlagSet("filetype", flag.ExitOnError)
+		mimeOnly := cmd.Bool("mime", false, "print only the MIME type")
+		cmd.Parse(os.Args[2:])
+		if cmd.NArg() == 0 {
+			log.Fatal("usage: file-type.go filetype [-mime] <path>...")
+		}
+		for _, path := range cmd.Args() {
+			printType(path, *mimeOnly)
+		}
+		// => ls: ELF, 64-bit shared object x86-64 (application/x-executable, 100%)
+		// => passwd: Unicode text, UTF-8, ASCII only (text/plain; charset=utf-8, 70%)
+		// => null: character device (inode/chardevice, 100%)
+	case "demo":
+		demo()
+	default:
+		log.Fatalf("unknown command %q", os.Args[1])
+	}
+}
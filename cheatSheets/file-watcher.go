@@ -0,0 +1,614 @@
+/////////////////////////////////
+// Watching Files and Directories with inotify
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+// inotify is a Linux API, it's used here through the syscall package.
+
+// Execute: go run file-watcher.go
+// (it watches a temporary directory and makes the create/rename/remove operations of files.go observable)
+// Execute: go test -v file-watcher.go file-watcher_test.go
+
+// Running a command on every change (like `make` or `go test` when a file is saved):
+// go run file-watcher.go watch [-r] [-debounce 200ms] <dir> -- <command> [args...]
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// declaring a defined type for the kind of change, the values are bit flags so they can be combined
+type op uint32
+
+const (
+	opCreate op = 1 << iota
+	opWrite
+	opRemove
+	opRename
+	opChmod
+	opOverflow // the kernel queue was full and events were lost: rescan what you need
+)
+
+// String method makes op a fmt.Stringer: opCreate|opWrite prints as CREATE|WRITE
+func (o op) String() string {
+	names := []string{"CREATE", "WRITE", "REMOVE", "RENAME", "CHMOD", "OVERFLOW"}
+	var parts []string
+	for i, n := range names {
+		if o&(1<<uint(i)) != 0 {
+			parts = append(parts, n)
+		}
+	}
+	return strings.Join(parts, "|")
+}
+
+// declaring a struct type for an event
+type event struct {
+	path string
+	op   op
+}
+
+/////////////////////////////////
+// The Watcher
+/////////////////////////////////
+
+// the changes we ask the kernel to report
+const watchMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_DELETE | syscall.IN_DELETE_SELF |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_MOVE_SELF | syscall.IN_ATTRIB
+
+// declaring a struct type for the watcher
+type watcher struct {
+	file      *os.File // the inotify file descriptor wrapped in an *os.File
+	recursive bool
+
+	mu      sync.Mutex
+	watches map[int32]string // watch descriptor -> watched path
+	paths   map[string]int32 // watched path -> watch descriptor
+
+	// used only by the readEvents() goroutine
+	movedFrom map[uint32]string // IN_MOVED_FROM cookie -> old path of a watched directory
+	renamed   map[int32]bool    // watched directories moved inside the tree, their IN_MOVE_SELF is expected
+
+	events    chan event
+	errors    chan error    // buffered: an error is dropped when nobody reads them and the buffer is full
+	done      chan struct{} // closed by close(): a send blocked on events gives up
+	closeOnce sync.Once
+}
+
+// declaring a function that creates an inotify instance
+func newWatcher(recursive bool) (*watcher, error) {
+	// IN_NONBLOCK makes the descriptor non-blocking, so os.NewFile() registers it with Go's network poller:
+	// a Read() doesn't block a thread and Close() interrupts it.
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &watcher{
+		file:      os.NewFile(uintptr(fd), "inotify"),
+		recursive: recursive,
+		watches:   make(map[int32]string),
+		paths:     make(map[string]int32),
+		movedFrom: make(map[uint32]string),
+		renamed:   make(map[int32]bool),
+		events:    make(chan event),
+		errors:    make(chan error, 16),
+		done:      make(chan struct{}),
+	}
+	go w.readEvents()
+	return w, nil
+}
+
+// add method starts watching a file or directory (and its subdirectories if the watcher is recursive)
+func (w *watcher) add(path string) error {
+	path = filepath.Clean(path)
+	if err := w.addOne(path); err != nil {
+		return err
+	}
+	if !w.recursive {
+		return nil
+	}
+	fileInfo, err := os.Stat(path)
+	if err != nil || !fileInfo.IsDir() {
+		return err
+	}
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p != path {
+			return w.addOne(p)
+		}
+		return nil
+	})
+}
+
+func (w *watcher) addOne(path string) error {
+	wd, err := syscall.InotifyAddWatch(int(w.file.Fd()), path, watchMask)
+	if err != nil {
+		return &fs.PathError{Op: "inotify_add_watch", Path: path, Err: err}
+	}
+	w.mu.Lock()
+	w.watches[int32(wd)] = path
+	w.paths[path] = int32(wd)
+	w.mu.Unlock()
+	return nil
+}
+
+// remove method stops watching a path
+func (w *watcher) remove(path string) error {
+	path = filepath.Clean(path)
+	w.mu.Lock()
+	wd, ok := w.paths[path]
+	w.mu.Unlock()
+	if !ok {
+		return &fs.PathError{Op: "inotify_rm_watch", Path: path, Err: errors.New("not watched")}
+	}
+	_, err := syscall.InotifyRmWatch(int(w.file.Fd()), uint32(wd))
+	return err
+}
+
+// close method stops the watcher; the events channel is closed, even if nobody reads it
+func (w *watcher) close() error {
+	err := os.ErrClosed
+	w.closeOnce.Do(func() {
+		close(w.done)
+		err = w.file.Close()
+	})
+	return err
+}
+
+// method that sends an event or returns false if the watcher was closed
+func (w *watcher) send(e event) bool {
+	select {
+	case w.events <- e:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// method that reports an error without blocking the events: a program that doesn't read
+// the errors channel must not stop the watcher
+func (w *watcher) sendError(err error) {
+	select {
+	case w.errors <- err:
+	default:
+	}
+}
+
+// method that reads the events from the kernel and sends them into the events channel
+func (w *watcher) readEvents() {
+	defer close(w.events)
+	defer close(w.errors)
+
+	// a buffer for many events; each one is a syscall.InotifyEvent followed by the file name
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if errors.Is(err, os.ErrClosed) {
+			return
+		}
+		if err != nil {
+			w.sendError(err)
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			// the raw bytes are interpreted as an InotifyEvent struct
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(raw.Len)]
+			name := string(bytes.TrimRight(nameBytes, "\x00")) // the name is padded with zero bytes
+			offset += syscall.SizeofInotifyEvent + int(raw.Len)
+
+			if !w.handle(raw, name) {
+				return
+			}
+		}
+	}
+}
+
+// method that handles one event of the kernel; it returns false if the watcher was closed
+func (w *watcher) handle(raw *syscall.InotifyEvent, name string) bool {
+	if raw.Mask&syscall.IN_Q_OVERFLOW != 0 {
+		if !w.send(event{op: opOverflow}) {
+			return false
+		}
+		return w.rescan()
+	}
+
+	w.mu.Lock()
+	dir, ok := w.watches[raw.Wd]
+	if raw.Mask&syscall.IN_IGNORED != 0 {
+		// the watch was removed (explicitly or because the path was deleted)
+		delete(w.watches, raw.Wd)
+		if w.paths[dir] == raw.Wd {
+			delete(w.paths, dir)
+		}
+		delete(w.renamed, raw.Wd)
+	}
+	w.mu.Unlock()
+	if !ok {
+		return true
+	}
+
+	path := dir
+	if name != "" {
+		path = filepath.Join(dir, name)
+	}
+	isDir := raw.Mask&syscall.IN_ISDIR != 0
+
+	// a watched directory renamed inside the watched tree: IN_MOVED_FROM and IN_MOVED_TO have the same cookie.
+	// The kernel sends both before the IN_MOVE_SELF of the directory.
+	if isDir && raw.Mask&syscall.IN_MOVED_FROM != 0 && w.watched(path) {
+		w.movedFrom[raw.Cookie] = path
+	}
+	if isDir && raw.Mask&syscall.IN_MOVED_TO != 0 {
+		if oldPath, ok := w.movedFrom[raw.Cookie]; ok {
+			delete(w.movedFrom, raw.Cookie)
+			w.rename(oldPath, path)
+			// the directory and its subdirectories are still watched: no add() and no scan()
+			return w.send(event{path: path, op: opCreate})
+		}
+	}
+	if raw.Mask&syscall.IN_MOVE_SELF != 0 {
+		if w.renamed[raw.Wd] {
+			delete(w.renamed, raw.Wd)
+			return true // reported as RENAME + CREATE by the parent directory
+		}
+		// moved out of the watched tree (or the watched root itself was moved): its new path is unknown.
+		// It's not watched anymore, otherwise its events would be reported under the old path.
+		seen := false
+		for cookie, p := range w.movedFrom {
+			if p == dir {
+				delete(w.movedFrom, cookie)
+				seen = true // the parent directory already reported the RENAME
+			}
+		}
+		w.unwatch(dir)
+		if seen {
+			return true
+		}
+	}
+
+	e := event{path: path, op: toOp(raw.Mask)}
+	if e.op == 0 {
+		return true
+	}
+	if !w.send(e) {
+		return false
+	}
+
+	// a new directory inside a recursively watched one is watched too.
+	// The files created in it before its watch was added have no event: they are found by a scan
+	// (a file created between the watch and the scan can be reported twice).
+	if w.recursive && e.op&opCreate != 0 && isDir {
+		if err := w.add(path); err != nil {
+			w.sendError(err)
+			return true
+		}
+		return w.scan(path)
+	}
+	return true
+}
+
+// method that reports if a path is watched
+func (w *watcher) watched(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.paths[path]
+	return ok
+}
+
+// a helper function that reports if path is dir or inside it
+func within(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// method that changes the paths of a renamed directory and of its watched subdirectories
+func (w *watcher) rename(oldPath, newPath string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for p, wd := range w.paths {
+		if !within(p, oldPath) {
+			continue
+		}
+		moved := newPath + p[len(oldPath):]
+		delete(w.paths, p)
+		w.paths[moved] = wd
+		w.watches[wd] = moved
+		if p == oldPath {
+			w.renamed[wd] = true
+		}
+	}
+}
+
+// method that stops watching a directory and its subdirectories
+// the maps are cleaned when the IN_IGNORED events arrive.
+func (w *watcher) unwatch(dir string) {
+	w.mu.Lock()
+	var wds []int32
+	for p, wd := range w.paths {
+		if within(p, dir) {
+			wds = append(wds, wd)
+		}
+	}
+	w.mu.Unlock()
+	for _, wd := range wds {
+		syscall.InotifyRmWatch(int(w.file.Fd()), uint32(wd))
+	}
+}
+
+// method that sends a CREATE event for everything inside a new directory
+// it returns false if the watcher was closed.
+func (w *watcher) scan(dir string) bool {
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != dir && !w.send(event{path: p, op: opCreate}) {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		w.sendError(err)
+	}
+	return !w.closed()
+}
+
+// method that reports if close() was called
+func (w *watcher) closed() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// method called after an overflow: the events of the directories created meanwhile were lost.
+// In a recursive watcher, the subdirectories that are not watched yet are added and scanned.
+// It returns false if the watcher was closed.
+func (w *watcher) rescan() bool {
+	if !w.recursive {
+		return true
+	}
+	w.mu.Lock()
+	dirs := make([]string, 0, len(w.paths))
+	for p := range w.paths {
+		dirs = append(dirs, p)
+	}
+	w.mu.Unlock()
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue // removed meanwhile, or a watched file
+		}
+		for _, e := range entries {
+			p := filepath.Join(dir, e.Name())
+			if !e.IsDir() || w.watched(p) {
+				continue
+			}
+			if !w.send(event{path: p, op: opCreate}) {
+				return false
+			}
+			if err := w.add(p); err != nil {
+				w.sendError(err)
+				continue
+			}
+			if !w.scan(p) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// declaring a function that converts the inotify mask to our op type
+func toOp(mask uint32) op {
+	var o op
+	if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		o |= opCreate
+	}
+	if mask&syscall.IN_MODIFY != 0 {
+		o |= opWrite
+	}
+	if mask&(syscall.IN_DELETE|syscall.IN_DELETE_SELF) != 0 {
+		o |= opRemove
+	}
+	if mask&(syscall.IN_MOVED_FROM|syscall.IN_MOVE_SELF) != 0 {
+		o |= opRename
+	}
+	if mask&syscall.IN_ATTRIB != 0 {
+		o |= opChmod
+	}
+	return o
+}
+
+/////////////////////////////////
+// Coalescing (Debouncing) Events
+/////////////////////////////////
+
+// Saving a file in an editor can produce many events in a few milliseconds.
+// debounce() merges the events of the same path and sends them as one batch,
+// after no new event arrived for the duration d.
+func debounce(in <-chan event, d time.Duration) <-chan []event {
+	out := make(chan []event)
+	go func() {
+		defer close(out)
+		pending := make(map[string]op)
+		var timer <-chan time.Time // a nil channel blocks forever, so the timer is off
+
+		flush := func() {
+			batch := make([]event, 0, len(pending))
+			for p, o := range pending {
+				batch = append(batch, event{path: p, op: o})
+			}
+			sort.Slice(batch, func(i, j int) bool { return batch[i].path < batch[j].path })
+			out <- batch
+			pending = make(map[string]op)
+			timer = nil
+		}
+
+		for {
+			select {
+			case e, ok := <-in:
+				if !ok {
+					if len(pending) > 0 {
+						flush()
+					}
+					return
+				}
+				pending[e.path] |= e.op
+				timer = time.After(d) // restarting the quiet period
+			case <-timer:
+				flush()
+			}
+		}
+	}()
+	return out
+}
+
+/////////////////////////////////
+// The watch Command
+/////////////////////////////////
+
+func watchCommand(args []string) {
+	cmdFlags := flag.NewFlagSet("watch", flag.ExitOnError)
+	recursive := cmdFlags.Bool("r", false, "watch subdirectories too")
+	delay := cmdFlags.Duration("debounce", 200*time.Millisecond, "wait for this quiet period before running the command")
+	cmdFlags.Parse(args)
+
+	// everything after -- is the command
+	rest := cmdFlags.Args()
+	if len(rest) < 3 || rest[1] != "--" {
+		log.Fatal("usage: file-watcher.go watch [-r] [-debounce 200ms] <dir> -- <command> [args...]")
+	}
+	dir, command := rest[0], rest[2:]
+
+	w, err := newWatcher(*recursive)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer w.close()
+	if err := w.add(dir); err != nil {
+		log.Fatal(err)
+	}
+
+	go func() {
+		for err := range w.errors {
+			log.Println(err)
+		}
+	}()
+
+	log.Printf("watching %s, running %q on change\n", dir, strings.Join(command, " "))
+	for batch := range debounce(w.events, *delay) {
+		for _, e := range batch {
+			log.Printf("%-8s %s\n", e.op, e.path)
+		}
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "watch" {
+		watchCommand(os.Args[2:])
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "watched")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := newWatcher(true)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := w.add(dir); err != nil {
+		log.Fatal(err)
+	}
+
+	// the errors must be read, or they're dropped when the buffer of the channel is full
+	go func() {
+		for err := range w.errors {
+			log.Println(err)
+		}
+	}()
+
+	// printing the events as they come, relative to the watched directory
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for e := range w.events {
+			rel, _ := filepath.Rel(dir, e.path)
+			fmt.Printf("%-8s %s\n", e.op, rel)
+		}
+	}()
+
+	// the operations of files.go
+	p := func(name string) string { return filepath.Join(dir, name) }
+	pause := func() { time.Sleep(50 * time.Millisecond) }
+
+	newFile, _ := os.Create(p("a.txt"))
+	newFile.Close()
+	pause()
+	os.WriteFile(p("a.txt"), []byte("I learn Golang!"), 0644)
+	pause()
+	os.Chmod(p("a.txt"), 0600)
+	pause()
+	os.Rename(p("a.txt"), p("aaa.txt"))
+	pause()
+	os.Remove(p("aaa.txt"))
+	pause()
+
+	// a file created in a new subdirectory is seen because the watcher is recursive
+	os.Mkdir(p("sub"), 0755)
+	pause()
+	os.WriteFile(p("sub/b.txt"), []byte("Go Programming is cool!"), 0644)
+	pause()
+
+	// a file created in a new directory before the watcher could add it is found by the scan
+	os.MkdirAll(p("new/deep"), 0755)
+	os.WriteFile(p("new/deep/c.txt"), []byte("Hello!"), 0644)
+	pause()
+
+	w.close()
+	<-done
+
+	// ** EXPECTED OUTPUT: **//
+	// CREATE   a.txt
+	// WRITE    a.txt
+	// CHMOD    a.txt
+	// RENAME   a.txt
+	// CREATE   aaa.txt
+	// REMOVE   aaa.txt
+	// CREATE   sub
+	// CREATE   sub/b.txt
+	// WRITE    sub/b.txt
+	// CREATE   new
+	// CREATE   new/deep
+	// CREATE   new/deep/c.txt
+}
@@ -0,0 +1,186 @@
+/////////////////////////////////
+// Tests: Watching Files and Directories with inotify
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// inotify is a Linux API: the tests run only on Linux.
+// Execute: go test -v file-watcher.go file-watcher_test.go
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// a helper function that creates a watcher on a new temporary directory, with the given subdirectories
+func startWatcher(t *testing.T, recursive bool, subdirs ...string) (*watcher, string) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, sub := range subdirs {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := newWatcher(recursive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.close() })
+	if err := w.add(dir); err != nil {
+		t.Fatal(err)
+	}
+	return w, dir
+}
+
+// a helper function that waits for the next event, with a path relative to dir
+func nextEvent(t *testing.T, w *watcher, dir string) event {
+	t.Helper()
+	select {
+	case e, ok := <-w.events:
+		if !ok {
+			t.Fatal("the events channel was closed")
+		}
+		rel, _ := filepath.Rel(dir, e.path)
+		return event{path: rel, op: e.op}
+	case err := <-w.errors:
+		t.Fatalf("unexpected error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event after 5s")
+	}
+	return event{}
+}
+
+// a helper function that reads events until the wanted one, failing on an unexpected path
+func expectEvent(t *testing.T, w *watcher, dir string, want event) {
+	t.Helper()
+	for {
+		e := nextEvent(t, w, dir)
+		if e == want {
+			return
+		}
+		if e.path != want.path {
+			t.Fatalf("got %v %s, want %v %s", e.op, e.path, want.op, want.path)
+		}
+	}
+}
+
+// a helper function that creates a file
+func touch(t *testing.T, path string) {
+	t.Helper()
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	w, dir := startWatcher(t, false)
+	p := filepath.Join(dir, "a.txt")
+
+	touch(t, p)
+	expectEvent(t, w, dir, event{"a.txt", opCreate})
+	if err := os.WriteFile(p, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, w, dir, event{"a.txt", opWrite})
+	if err := os.Remove(p); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, w, dir, event{"a.txt", opRemove})
+}
+
+func TestRecursiveNewDirectory(t *testing.T) {
+	w, dir := startWatcher(t, true)
+	if err := os.MkdirAll(filepath.Join(dir, "new", "deep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, w, dir, event{"new", opCreate})
+	expectEvent(t, w, dir, event{"new/deep", opCreate})
+
+	touch(t, filepath.Join(dir, "new", "deep", "c.txt"))
+	expectEvent(t, w, dir, event{"new/deep/c.txt", opCreate})
+}
+
+func TestRenameWatchedDirectory(t *testing.T) {
+	// the directories exist before the watcher: a late IN_CREATE of old/sub can't race with the rename
+	w, dir := startWatcher(t, true, "old/sub")
+	if err := os.Rename(filepath.Join(dir, "old"), filepath.Join(dir, "new")); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, w, dir, event{"old", opRename})
+	expectEvent(t, w, dir, event{"new", opCreate})
+
+	// the events of the subdirectories are reported with the new path
+	touch(t, filepath.Join(dir, "new", "sub", "a.txt"))
+	expectEvent(t, w, dir, event{"new/sub/a.txt", opCreate})
+	for _, p := range []string{"new", "new/sub"} {
+		if !w.watched(filepath.Join(dir, p)) {
+			t.Errorf("%s is not watched", p)
+		}
+	}
+	if w.watched(filepath.Join(dir, "old")) {
+		t.Error("the old path is still watched")
+	}
+}
+
+func TestMoveOutOfTree(t *testing.T) {
+	outside := t.TempDir()
+	w, dir := startWatcher(t, true, "sub")
+	if err := os.Rename(filepath.Join(dir, "sub"), filepath.Join(outside, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, w, dir, event{"sub", opRename})
+
+	// the directory is not watched anymore: a file created in it has no event under the old path
+	touch(t, filepath.Join(outside, "sub", "a.txt"))
+	touch(t, filepath.Join(dir, "b.txt"))
+	expectEvent(t, w, dir, event{"b.txt", opCreate})
+}
+
+func TestRescan(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "lost", "deep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, filepath.Join(dir, "lost", "deep", "c.txt"))
+
+	// only the root is watched, like after an overflow that lost the events of "lost"
+	w, err := newWatcher(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+	if err := w.addOne(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	go w.rescan()
+	expectEvent(t, w, dir, event{"lost", opCreate})
+	expectEvent(t, w, dir, event{"lost/deep", opCreate})
+	expectEvent(t, w, dir, event{"lost/deep/c.txt", opCreate})
+	if !w.watched(filepath.Join(dir, "lost", "deep")) {
+		t.Error("lost/deep is not watched after the rescan")
+	}
+}
+
+func TestCloseWithoutReading(t *testing.T) {
+	w, dir := startWatcher(t, true)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		touch(t, filepath.Join(dir, name))
+	}
+	time.Sleep(50 * time.Millisecond) // the watcher is blocked sending the first event
+
+	w.close()
+	time.Sleep(50 * time.Millisecond) // the watcher gives up the send and closes the channel
+
+	select {
+	case e, ok := <-w.events:
+		if ok {
+			t.Fatalf("got %v %s after close(), want a closed channel", e.op, e.path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the events channel was not closed")
+	}
+}
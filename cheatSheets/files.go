@@ -101,7 +101,7 @@ func main() {
 	}
 
 	// REMOVING A FILE
-	err = os.Remove("aa.txt")
+	err = os.Remove("aaa.txt")
 	// error handling
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,634 @@
+/////////////////////////////////
+// A Writable File System Interface (OS, In-Memory and Copy-on-Write Overlay)
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+// Execute: go run filesystem-abstraction.go
+// Execute: go test -v filesystem-abstraction.go filesystem-abstraction_test.go
+
+// The examples in files.go work directly on the current working directory.
+// Here the same operations are written against an interface, so they can run on the real disk,
+// completely in memory, or in memory on top of the real disk (the disk is read but never changed).
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// declaring an interface type for an open file; *os.File implements it
+type file interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+	Name() string
+	Stat() (fs.FileInfo, error)
+}
+
+// declaring an interface type for a file system that can be written to
+// io/fs.FS is read-only, so we need our own interface for the write operations.
+type writableFS interface {
+	Open(name string) (file, error)                                 // like os.Open()
+	Create(name string) (file, error)                               // like os.Create()
+	OpenFile(name string, flag int, perm fs.FileMode) (file, error) // like os.OpenFile()
+	Rename(oldPath, newPath string) error
+	Remove(name string) error
+	Truncate(name string, size int64) error
+	Stat(name string) (fs.FileInfo, error)
+}
+
+/////////////////////////////////
+// The OS Implementation
+/////////////////////////////////
+
+// osFS uses the os package: every path is relative to dir, or to the current working directory if dir is ""
+type osFS struct {
+	dir string
+}
+
+func (o osFS) path(name string) string { return filepath.Join(o.dir, name) }
+
+func (o osFS) Open(name string) (file, error)   { return os.Open(o.path(name)) }
+func (o osFS) Create(name string) (file, error) { return os.Create(o.path(name)) }
+func (o osFS) OpenFile(name string, flag int, perm fs.FileMode) (file, error) {
+	return os.OpenFile(o.path(name), flag, perm)
+}
+func (o osFS) Rename(oldPath, newPath string) error {
+	return os.Rename(o.path(oldPath), o.path(newPath))
+}
+func (o osFS) Remove(name string) error               { return os.Remove(o.path(name)) }
+func (o osFS) Truncate(name string, size int64) error { return os.Truncate(o.path(name), size) }
+func (o osFS) Stat(name string) (fs.FileInfo, error)  { return os.Stat(o.path(name)) }
+
+/////////////////////////////////
+// The In-Memory Implementation
+/////////////////////////////////
+
+// declaring a struct type for the content and metadata of a file in memory
+type memNode struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// declaring a struct type for a flat in-memory file system (there are no directories)
+type memFS struct {
+	mu    sync.Mutex
+	files map[string]*memNode
+}
+
+func newMemFS() *memFS {
+	return &memFS{files: make(map[string]*memNode)}
+}
+
+// the errors are *fs.PathError values like the ones of the os package,
+// so os.IsNotExist(err) and errors.Is(err, fs.ErrNotExist) work the same way.
+func pathError(op, name string, err error) error {
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (m *memFS) Open(name string) (file, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *memFS) Create(name string) (file, error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (m *memFS) OpenFile(name string, flag int, perm fs.FileMode) (file, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = path.Clean(name)
+	node, ok := m.files[name]
+	switch {
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, pathError("open", name, fs.ErrNotExist)
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, pathError("open", name, fs.ErrExist)
+	case !ok:
+		node = &memNode{mode: perm, modTime: time.Now()}
+		m.files[name] = node
+	}
+	if flag&os.O_TRUNC != 0 && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		node.data = nil
+		node.modTime = time.Now()
+	}
+	return &memFile{fs: m, name: name, node: node, flag: flag}, nil
+}
+
+func (m *memFS) Rename(oldPath, newPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldPath, newPath = path.Clean(oldPath), path.Clean(newPath)
+	node, ok := m.files[oldPath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrNotExist}
+	}
+	delete(m.files, oldPath)
+	m.files[newPath] = node // like os.Rename(), an existing file is replaced
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = path.Clean(name)
+	if _, ok := m.files[name]; !ok {
+		return pathError("remove", name, fs.ErrNotExist)
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m *memFS) Truncate(name string, size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = path.Clean(name)
+	node, ok := m.files[name]
+	if !ok {
+		return pathError("truncate", name, fs.ErrNotExist)
+	}
+	node.resize(size)
+	return nil
+}
+
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = path.Clean(name)
+	node, ok := m.files[name]
+	if !ok {
+		return nil, pathError("stat", name, fs.ErrNotExist)
+	}
+	return node.info(name), nil
+}
+
+// method that lists the file names, sorted
+func (m *memFS) names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.files))
+	for n := range m.files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// method that shrinks the data or extends it with zero bytes
+func (n *memNode) resize(size int64) {
+	if size < int64(len(n.data)) {
+		n.data = n.data[:size]
+	} else {
+		n.data = append(n.data, make([]byte, size-int64(len(n.data)))...)
+	}
+	n.modTime = time.Now()
+}
+
+func (n *memNode) info(name string) fs.FileInfo {
+	return memFileInfo{name: path.Base(name), size: int64(len(n.data)), mode: n.mode, modTime: n.modTime}
+}
+
+// declaring a struct type that implements the fs.FileInfo interface
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return fi.size }
+func (fi memFileInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi memFileInfo) IsDir() bool        { return false }
+func (fi memFileInfo) Sys() interface{}   { return nil }
+
+// declaring a struct type for an open in-memory file
+// like an *os.File, it has its own offset but shares the content with the other open files.
+type memFile struct {
+	fs     *memFS
+	name   string
+	node   *memNode
+	flag   int
+	offset int64
+	closed bool
+}
+
+func (f *memFile) Name() string { return f.name }
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.flag&os.O_WRONLY != 0 {
+		return 0, pathError("read", f.name, errors.New("bad file descriptor"))
+	}
+	if f.offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, pathError("write", f.name, errors.New("bad file descriptor"))
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.node.data))
+	}
+	if end := f.offset + int64(len(p)); end > int64(len(f.node.data)) {
+		f.node.resize(end)
+	}
+	n := copy(f.node.data[f.offset:], p)
+	f.offset += int64(n)
+	f.node.modTime = time.Now()
+	return n, nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return 0, pathError("seek", f.name, errors.New("invalid argument"))
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	return f.node.info(f.name), nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	return nil
+}
+
+/////////////////////////////////
+// The Copy-on-Write Overlay
+/////////////////////////////////
+
+// declaring a struct type that reads from a base file system and writes to an upper one.
+// A file is copied to the upper file system the first time it's changed ("copy-up")
+// and a removed base file is remembered in a set (a "whiteout") so that it's hidden.
+type overlayFS struct {
+	base  writableFS // never changed
+	upper *memFS
+
+	mu      sync.Mutex
+	removed map[string]bool
+}
+
+func newOverlayFS(base writableFS) *overlayFS {
+	return &overlayFS{base: base, upper: newMemFS(), removed: make(map[string]bool)}
+}
+
+func (o *overlayFS) isRemoved(name string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.removed[path.Clean(name)]
+}
+
+func (o *overlayFS) setRemoved(name string, removed bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.removed[path.Clean(name)] = removed
+}
+
+// method that copies a base file to the upper file system if it's not there yet
+func (o *overlayFS) copyUp(name string) error {
+	if _, err := o.upper.Stat(name); err == nil {
+		return nil
+	}
+	if o.isRemoved(name) {
+		return pathError("open", name, fs.ErrNotExist)
+	}
+	src, err := o.base.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fileInfo, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := o.upper.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fileInfo.Mode())
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+func (o *overlayFS) Open(name string) (file, error) {
+	return o.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (o *overlayFS) Create(name string) (file, error) {
+	return o.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (o *overlayFS) OpenFile(name string, flag int, perm fs.FileMode) (file, error) {
+	write := flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0
+
+	// reading: the upper file system first, then the base one
+	if !write {
+		if f, err := o.upper.OpenFile(name, flag, perm); err == nil {
+			return f, nil
+		}
+		if o.isRemoved(name) {
+			return nil, pathError("open", name, fs.ErrNotExist)
+		}
+		return o.base.OpenFile(name, flag, perm)
+	}
+
+	// O_EXCL fails if the file exists in any layer, not only in the upper one
+	if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		if _, err := o.Stat(name); err == nil {
+			return nil, pathError("open", name, fs.ErrExist)
+		}
+	}
+
+	// writing: the file is copied up, unless it's truncated anyway
+	if flag&os.O_TRUNC == 0 {
+		if err := o.copyUp(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	} else if _, err := o.Stat(name); err == nil {
+		flag |= os.O_CREATE // the file exists in the base, so it exists in the overlay
+	}
+	f, err := o.upper.OpenFile(name, flag, perm)
+	if err == nil {
+		o.setRemoved(name, false)
+	}
+	return f, err
+}
+
+// a helper function that returns the error inside a *fs.PathError, to wrap it again with the right operation
+func underlying(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	return err
+}
+
+func (o *overlayFS) Rename(oldPath, newPath string) error {
+	if err := o.copyUp(oldPath); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: underlying(err)}
+	}
+	if err := o.upper.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	o.setRemoved(oldPath, true)
+	o.setRemoved(newPath, false)
+	return nil
+}
+
+func (o *overlayFS) Remove(name string) error {
+	if _, err := o.Stat(name); err != nil {
+		return pathError("remove", name, fs.ErrNotExist)
+	}
+	o.upper.Remove(name) // it may exist only in the base
+	o.setRemoved(name, true)
+	return nil
+}
+
+func (o *overlayFS) Truncate(name string, size int64) error {
+	if err := o.copyUp(name); err != nil {
+		return pathError("truncate", name, underlying(err))
+	}
+	return o.upper.Truncate(name, size)
+}
+
+func (o *overlayFS) Stat(name string) (fs.FileInfo, error) {
+	if fileInfo, err := o.upper.Stat(name); err == nil {
+		return fileInfo, nil
+	}
+	if o.isRemoved(name) {
+		return nil, pathError("stat", name, fs.ErrNotExist)
+	}
+	return o.base.Stat(name)
+}
+
+/////////////////////////////////
+// The Examples of files.go, Ported to the Interface
+/////////////////////////////////
+
+// a helper function like ioutil.WriteFile()
+func writeFile(fsys writableFS, name string, data []byte, perm fs.FileMode) error {
+	f, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// a helper function like ioutil.ReadFile()
+func readFile(fsys writableFS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// declaring a function that runs the file examples on any file system
+// instead of calling log.Fatal() it returns the error, so the caller (or a test) decides what to do.
+func fileExamples(fsys writableFS, out io.Writer) error {
+	p := func(a ...interface{}) { fmt.Fprintln(out, a...) }
+
+	// CREATING AND TRUNCATING A FILE
+	newFile, err := fsys.Create("a.txt")
+	if err != nil {
+		return err
+	}
+	if err := fsys.Truncate("a.txt", 0); err != nil {
+		return err
+	}
+	newFile.Close()
+
+	// OPENING A FILE WITH MORE OPTIONS
+	file, err := fsys.OpenFile("a.txt", os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	file.Close()
+
+	// GETTING FILE INFO
+	fileInfo, err := fsys.Stat("a.txt")
+	if err != nil {
+		return err
+	}
+	p("File Name:", fileInfo.Name())     // => File Name: a.txt
+	p("Size in bytes:", fileInfo.Size()) // => Size in bytes: 0
+
+	// CHECKING IF FILE EXISTS
+	if _, err := fsys.Stat("b.txt"); os.IsNotExist(err) {
+		p("b.txt does not exist yet")
+	}
+
+	// RENAMING AND REMOVING A FILE (the renamed file, aaa.txt, is the one that exists)
+	if err := fsys.Rename("a.txt", "aaa.txt"); err != nil {
+		return err
+	}
+	if err := fsys.Remove("aaa.txt"); err != nil {
+		return err
+	}
+
+	// WRITING BYTES TO FILES
+	file, err = fsys.OpenFile("b.txt", os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	bytesWritten, err := file.Write([]byte("I learn Golang! 传"))
+	file.Close()
+	if err != nil {
+		return err
+	}
+	p("Bytes written:", bytesWritten) // => Bytes written: 19
+
+	if err := writeFile(fsys, "c.txt", []byte("Go Programming is cool!"), 0644); err != nil {
+		return err
+	}
+
+	// WRITING TO FILES USING A BUFFER IN MEMORY
+	file, err = fsys.OpenFile("my_file.txt", os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	bufferedWriter := bufio.NewWriter(file)
+	bufferedWriter.Write([]byte{97, 98, 99})
+	bufferedWriter.WriteString("\nJust a random string")
+	err = bufferedWriter.Flush()
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	// READING INTO A BYTE SLICE USING io.ReadFull()
+	file, err = fsys.Open("b.txt")
+	if err != nil {
+		return err
+	}
+	byteSlice := make([]byte, 2)
+	if _, err := io.ReadFull(file, byteSlice); err != nil {
+		return err
+	}
+	file.Close()
+	p("Data read:", string(byteSlice)) // => Data read: I
+
+	// READING A WHOLE FILE
+	data, err := readFile(fsys, "c.txt")
+	if err != nil {
+		return err
+	}
+	p("Data read:", string(data)) // => Data read: Go Programming is cool!
+
+	// READING LINE BY LINE USING bufio.Scanner
+	file, err = fsys.Open("my_file.txt")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		p(scanner.Text())
+	}
+	// => abc
+	// => Just a random string
+	return scanner.Err()
+}
+
+func main() {
+	// 1. IN MEMORY: nothing is written to disk
+	mem := newMemFS()
+	if err := fileExamples(mem, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Files in memory:", mem.names()) // => Files in memory: [b.txt c.txt my_file.txt]
+
+	fmt.Println(strings.Repeat("#", 20))
+
+	// 2. AN OVERLAY ON TOP OF A DIRECTORY ON DISK
+	// the files of the directory can be read, but all the changes stay in memory.
+	dir, err := os.MkdirTemp("", "overlay")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("on disk"), 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	overlay := newOverlayFS(osFS{dir: dir})
+	if err := fileExamples(overlay, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Files changed:", overlay.upper.names()) // => Files changed: [b.txt c.txt my_file.txt]
+
+	if _, err := os.Stat(filepath.Join(dir, "my_file.txt")); os.IsNotExist(err) {
+		fmt.Println("my_file.txt was not written to disk") // => my_file.txt was not written to disk
+	}
+
+	// a file of the directory can be "removed" from the overlay only
+	data, err := readFile(overlay, "notes.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("notes.txt: %q\n", data) // => notes.txt: "on disk"
+
+	// an exclusive create fails: notes.txt exists in the base, even if not in the upper layer
+	_, err = overlay.OpenFile("notes.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	fmt.Println(errors.Is(err, fs.ErrExist)) // => true
+
+	overlay.Remove("notes.txt")
+	_, err = overlay.Stat("notes.txt")
+	fmt.Println(os.IsNotExist(err)) // => true
+	_, err = os.Stat(filepath.Join(dir, "notes.txt"))
+	fmt.Println("still on disk:", err == nil) // => still on disk: true
+}
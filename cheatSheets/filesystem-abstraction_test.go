@@ -0,0 +1,209 @@
+/////////////////////////////////
+// Tests: the In-Memory File System and the Copy-on-Write Overlay
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Execute: go test -v filesystem-abstraction.go filesystem-abstraction_test.go
+
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// the output of fileExamples(), the same on every file system
+const examplesOutput = "File Name: a.txt\n" +
+	"Size in bytes: 0\n" +
+	"b.txt does not exist yet\n" +
+	"Bytes written: 19\n" +
+	"Data read: I \n" + // the 2 bytes read are "I "
+	"Data read: Go Programming is cool!\n" +
+	"abc\n" +
+	"Just a random string\n"
+
+// a helper function that returns the names of the files in a directory on disk
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+// a helper function that checks the content of a file
+func checkFile(t *testing.T, fsys writableFS, name, want string) {
+	t.Helper()
+	data, err := readFile(fsys, name)
+	if err != nil {
+		t.Fatalf("readFile(%s): %v", name, err)
+	}
+	if string(data) != want {
+		t.Errorf("%s = %q, want %q", name, data, want)
+	}
+}
+
+func TestFileExamples(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		fsys writableFS
+	}{
+		{"disk", osFS{dir: dir}},
+		{"memory", newMemFS()},
+		{"overlay", newOverlayFS(osFS{dir: t.TempDir()})},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		if err := fileExamples(tt.fsys, &out); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if out.String() != examplesOutput {
+			t.Errorf("%s: the output is\n%s\nwant\n%s", tt.name, out.String(), examplesOutput)
+		}
+	}
+
+	want := []string{"b.txt", "c.txt", "my_file.txt"}
+	if got := dirNames(t, dir); !slices.Equal(got, want) {
+		t.Errorf("files on disk = %v, want %v", got, want)
+	}
+	if got := tests[1].fsys.(*memFS).names(); !slices.Equal(got, want) {
+		t.Errorf("files in memory = %v, want %v", got, want)
+	}
+}
+
+func TestMemFS(t *testing.T) {
+	m := newMemFS()
+	if _, err := m.Open("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open(missing.txt) = %v, want ErrNotExist", err)
+	}
+	if err := writeFile(m, "a.txt", []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.OpenFile("a.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("O_EXCL on an existing file = %v, want ErrExist", err)
+	}
+
+	// two open files share the content but not the offset
+	r, err := m.Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	w, err := m.OpenFile("a.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 3)
+	if _, err := io.ReadFull(r, p); err != nil || string(p) != "hel" {
+		t.Errorf("Read() = %q, %v; want %q", p, err, "hel")
+	}
+	if _, err := w.Write([]byte(" world")); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if rest, _ := io.ReadAll(r); string(rest) != "lo world" {
+		t.Errorf("the rest = %q, want %q", rest, "lo world")
+	}
+	if _, err := w.Write([]byte("!")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Write() after Close() = %v, want ErrClosed", err)
+	}
+	if _, err := r.(io.Writer).Write([]byte("!")); err == nil {
+		t.Error("Write() on a read-only file succeeded")
+	}
+
+	// Truncate() extends with zero bytes, Rename() replaces the target
+	if err := m.Truncate("a.txt", 7); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, m, "a.txt", "hello w")
+	if err := m.Truncate("a.txt", 9); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, m, "a.txt", "hello w\x00\x00")
+	if err := writeFile(m, "b.txt", []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Rename("a.txt", "./b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.names(); !slices.Equal(got, []string{"b.txt"}) {
+		t.Errorf("names() after Rename() = %v, want [b.txt]", got)
+	}
+	if err := m.Remove("a.txt"); !os.IsNotExist(err) {
+		t.Errorf("Remove() of a renamed file = %v, want ErrNotExist", err)
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{"base.txt": "base", "gone.txt": "gone", "moved.txt": "moved"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	o := newOverlayFS(osFS{dir: dir})
+
+	// reading goes to the base, writing copies the file up
+	checkFile(t, o, "base.txt", "base")
+	f, err := o.OpenFile("base.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(" changed"))
+	f.Close()
+	checkFile(t, o, "base.txt", "base changed")
+
+	// O_EXCL sees the files of the base
+	if _, err := o.OpenFile("moved.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("O_EXCL on a base file = %v, want ErrExist", err)
+	}
+
+	// a removed base file is hidden, and can be created again
+	if err := o.Remove("gone.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Stat("gone.txt"); !os.IsNotExist(err) {
+		t.Errorf("Stat() of a removed file = %v, want ErrNotExist", err)
+	}
+	if err := o.Truncate("gone.txt", 0); !os.IsNotExist(err) {
+		t.Errorf("Truncate() of a removed file = %v, want ErrNotExist", err)
+	}
+	if err := writeFile(o, "gone.txt", []byte("back"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, o, "gone.txt", "back")
+
+	// renaming hides the old name
+	if err := o.Rename("moved.txt", "new.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Open("moved.txt"); !os.IsNotExist(err) {
+		t.Errorf("Open() of the old name = %v, want ErrNotExist", err)
+	}
+	checkFile(t, o, "new.txt", "moved")
+	if err := o.Rename("moved.txt", "again.txt"); !os.IsNotExist(err) {
+		t.Errorf("Rename() of the old name = %v, want ErrNotExist", err)
+	}
+
+	// the directory on disk was never changed
+	want := []string{"base.txt", "gone.txt", "moved.txt"}
+	if got := dirNames(t, dir); !slices.Equal(got, want) {
+		t.Errorf("files on disk = %v, want %v", got, want)
+	}
+	checkFile(t, osFS{dir: dir}, "base.txt", "base")
+	if got := o.upper.names(); !slices.Equal(got, []string{"base.txt", "gone.txt", "new.txt"}) {
+		t.Errorf("files changed = %v, want [base.txt gone.txt new.txt]", got)
+	}
+}
@@ -0,0 +1,274 @@
+/////////////////////////////////
+// Detecting Goroutine Leaks
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+// Execute: go run goroutine-leaks.go
+// Execute: go test -v goroutine-leaks.go goroutine-leaks_test.go
+
+// go-routines-waitgroups.go prints runtime.NumGoroutine(), but a number doesn't say WHICH goroutine leaked.
+// runtime.Stack(buf, true) writes the stack of every goroutine:
+//	goroutine 7 [chan send]:
+//	main.selectWithTimeout.func1()
+//		/home/andrei/goroutine-leaks.go:199 +0x36
+//	created by main.selectWithTimeout in goroutine 1
+//		/home/andrei/goroutine-leaks.go:197 +0x86
+// Comparing the goroutines before and after some code finds the ones it left behind.
+// A goroutine blocked forever is a memory leak: its stack and everything it references are never freed.
+//
+// The checker works with *testing.T (it only needs Helper() and Errorf()), see goroutine-leaks_test.go:
+//	func TestSelect(t *testing.T) {
+//		defer verifyNoLeaks(t, leakOptions{})()
+//		...
+//	}
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/////////////////////////////////
+// Snapshots of the Goroutines
+/////////////////////////////////
+
+// declaring a struct type for a goroutine of a snapshot
+type goroutine struct {
+	id    int
+	state string // chan send, chan receive, select, sleep, running, ...
+	stack string
+}
+
+// the first line of every goroutine in the output of runtime.Stack()
+var headerRegexp = regexp.MustCompile(`^goroutine (\d+) \[([^\]]+)\]:`)
+
+// declaring a function that returns all the goroutines, except the one calling it
+func snapshot() []goroutine {
+	// the buffer grows until all the stacks fit
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	var goroutines []goroutine
+	// the stacks are separated by an empty line, the first one is the current goroutine
+	for i, block := range strings.Split(string(buf), "\n\n") {
+		m := headerRegexp.FindStringSubmatch(block)
+		if i == 0 || m == nil {
+			continue
+		}
+		id, _ := strconv.Atoi(m[1])
+		goroutines = append(goroutines, goroutine{id: id, state: m[2], stack: block})
+	}
+	return goroutines
+}
+
+/////////////////////////////////
+// The Leak Checker
+/////////////////////////////////
+
+// declaring a struct type for the options of the checker
+type leakOptions struct {
+	// how long to wait for goroutines that are returning (default 1 second)
+	retryFor time.Duration
+	// goroutines whose stack contains one of these strings are never leaks (background workers started on purpose)
+	ignore []string
+}
+
+// goroutines of the runtime and of the standard library that run in the background
+var defaultIgnore = []string{
+	"os/signal.signal_recv",
+	"os/signal.loop",
+	"runtime.ensureSigM",
+	"testing.(*T).Run",
+	"testing.tRunner.func1",
+	"testing.runTests",
+}
+
+// declaring an interface with the methods of *testing.T used by the checker
+type testingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// declaring a function that returns the goroutines that are not in before and not ignored.
+// It retries with a growing delay: a goroutine that just got its value may need a moment to return.
+func findLeaks(before []goroutine, opts leakOptions) []goroutine {
+	known := make(map[int]bool, len(before))
+	for _, g := range before {
+		known[g.id] = true
+	}
+	ignore := slices.Concat(defaultIgnore, opts.ignore) // append() could write into the array of defaultIgnore
+	retryFor := opts.retryFor
+	if retryFor == 0 {
+		retryFor = time.Second
+	}
+
+	deadline := time.Now().Add(retryFor)
+	delay := time.Millisecond
+	for {
+		var leaks []goroutine
+	next:
+		for _, g := range snapshot() {
+			if known[g.id] {
+				continue
+			}
+			for _, s := range ignore {
+				if strings.Contains(g.stack, s) {
+					continue next
+				}
+			}
+			leaks = append(leaks, g)
+		}
+		if len(leaks) == 0 || time.Now().After(deadline) {
+			return leaks
+		}
+		runtime.Gosched()
+		time.Sleep(delay)
+		delay = min(2*delay, 100*time.Millisecond)
+	}
+}
+
+// declaring a function that takes a snapshot now and returns a function that checks for leaks.
+// It's used with defer: defer verifyNoLeaks(t, leakOptions{})()
+func verifyNoLeaks(t testingT, opts leakOptions) func() {
+	before := snapshot()
+	return func() {
+		t.Helper()
+		leaks := findLeaks(before, opts)
+		if len(leaks) == 0 {
+			return
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "found %d leaked goroutine(s):\n", len(leaks))
+		for _, g := range leaks {
+			fmt.Fprintf(&b, "\n%s\n", g.stack)
+		}
+		t.Errorf("%s", b.String())
+	}
+}
+
+/////////////////////////////////
+// The select Examples of channels.go
+/////////////////////////////////
+
+// the example of channels.go: both messages are received, both goroutines return
+func selectBoth() []string {
+	c1 := make(chan string)
+	c2 := make(chan string)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		c1 <- "Hello!"
+	}()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c2 <- "Salut!"
+	}()
+
+	var received []string
+	for i := 0; i < 2; i++ {
+		select {
+		case msg1 := <-c1:
+			received = append(received, msg1)
+		case msg2 := <-c2:
+			received = append(received, msg2)
+		}
+	}
+	return received
+}
+
+// the same select with a timeout: the first message wins, nobody receives from the other channel.
+// Its goroutine stays blocked on `c1 <- "Hello!"` forever: a LEAK.
+func selectWithTimeout() string {
+	c1 := make(chan string)
+	c2 := make(chan string)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		c1 <- "Hello!"
+	}()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c2 <- "Salut!"
+	}()
+
+	select {
+	case msg := <-c1:
+		return msg
+	case msg := <-c2:
+		return msg
+	case <-time.After(time.Second):
+		return "timeout"
+	}
+}
+
+// the fix: buffered channels with room for one value, so the send never blocks.
+// The slower goroutine is still sleeping when the function returns: the checker retries until it's done.
+func selectWithTimeoutFixed() string {
+	c1 := make(chan string, 1)
+	c2 := make(chan string, 1)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		c1 <- "Hello!"
+	}()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c2 <- "Salut!"
+	}()
+
+	select {
+	case msg := <-c1:
+		return msg
+	case msg := <-c2:
+		return msg
+	case <-time.After(time.Second):
+		return "timeout"
+	}
+}
+
+// a goroutine that runs for the whole life of the program on purpose
+func metricsReporter(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func main() {
+	// goroutine-leaks_test.go runs these examples as tests, with verifyNoLeaks()
+	fmt.Println(selectBoth()) // => [Salut! Hello!]
+
+	before := snapshot()
+	fmt.Println(selectWithTimeout()) // => Salut!
+	for _, g := range findLeaks(before, leakOptions{retryFor: 200 * time.Millisecond}) {
+		fmt.Printf("leaked:\n%s\n", g.stack)
+	}
+	// => leaked:
+	// => goroutine 9 [chan send]:
+	// => main.selectWithTimeout.func1()
+	// => 	/home/andrei/goroutine-leaks.go:199 +0x36
+	// => created by main.selectWithTimeout in goroutine 1
+	// => 	/home/andrei/goroutine-leaks.go:197 +0x86
+
+	before = snapshot()
+	fmt.Println(selectWithTimeoutFixed())                        // => Salut!
+	fmt.Println("leaks:", len(findLeaks(before, leakOptions{}))) // => leaks: 0
+
+	fmt.Println("goroutines:", runtime.NumGoroutine()) // => goroutines: 2 (main and the leaked sender)
+}
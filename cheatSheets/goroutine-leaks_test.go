@@ -0,0 +1,85 @@
+/////////////////////////////////
+// Tests: the Leak Checker with a Real *testing.T
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Execute: go test -v goroutine-leaks.go goroutine-leaks_test.go
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelectBoth(t *testing.T) {
+	defer verifyNoLeaks(t, leakOptions{})()
+	if got, want := selectBoth(), []string{"Salut!", "Hello!"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSelectWithTimeoutFixed(t *testing.T) {
+	defer verifyNoLeaks(t, leakOptions{})()
+	if got := selectWithTimeoutFixed(); got != "Salut!" {
+		t.Errorf("got %q, want %q", got, "Salut!")
+	}
+}
+
+// a background goroutine is reported, unless it's ignored
+func TestSelectBackgroundIgnored(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+	defer verifyNoLeaks(t, leakOptions{ignore: []string{".metricsReporter("}})()
+	go metricsReporter(stop)
+}
+
+// declaring a struct type that records the failure of a check, instead of failing the test
+type recorder struct {
+	failed bool
+	msg    string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.failed = true
+	r.msg = fmt.Sprintf(format, args...)
+}
+
+// the leak of selectWithTimeout() must be found: the checker reports it to the recorder, the test checks the report.
+// (the functions are in package command-line-arguments, not main, with go test X.go X_test.go)
+func TestSelectWithTimeoutLeakFound(t *testing.T) {
+	rec := &recorder{}
+	check := verifyNoLeaks(rec, leakOptions{retryFor: 200 * time.Millisecond})
+	if got := selectWithTimeout(); got != "Salut!" {
+		t.Errorf("got %q, want %q", got, "Salut!")
+	}
+	check()
+	if !rec.failed {
+		t.Fatal("the leaked goroutine was not found")
+	}
+	for _, want := range []string{"found 1 leaked goroutine(s)", "[chan send]", ".selectWithTimeout.func1()"} {
+		if !strings.Contains(rec.msg, want) {
+			t.Errorf("the report doesn't contain %q:\n%s", want, rec.msg)
+		}
+	}
+}
+
+// the ignore option must not change the default list shared by all the checks
+func TestIgnoreKeepsDefaults(t *testing.T) {
+	saved := defaultIgnore
+	defer func() { defaultIgnore = saved }()
+	defaultIgnore = make([]string, len(saved), len(saved)+10) // room for append() to write into
+	copy(defaultIgnore, saved)
+
+	findLeaks(snapshot(), leakOptions{retryFor: time.Millisecond, ignore: []string{"first"}})
+	findLeaks(snapshot(), leakOptions{retryFor: time.Millisecond, ignore: []string{"second"}})
+	if full := defaultIgnore[:cap(defaultIgnore)]; slices.Contains(full, "first") || slices.Contains(full, "second") {
+		t.Errorf("defaultIgnore was modified: %q", full[:len(saved)+2])
+	}
+}
@@ -0,0 +1,524 @@
+/////////////////////////////////
+// An Interactive Line Editor for Reading From Standard Input (raw terminal mode)
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+// It uses Linux terminal ioctls (TCGETS, TCSETS) through the syscall package.
+// Execute: go run line-editor.go
+
+// Keys:
+// Left/Right, Ctrl-B/Ctrl-F    move the cursor     Home/End, Ctrl-A/Ctrl-E   start/end of line
+// Up/Down, Ctrl-P/Ctrl-N       history             Ctrl-R                    search the history
+// Backspace, Delete, Ctrl-W    delete              Ctrl-U/Ctrl-K             delete to start/end
+// Tab                          complete            Ctrl-C/Ctrl-D             interrupt/end of input
+
+// When stdin is not a terminal (echo hello | go run line-editor.go) it falls back to bufio.Scanner.
+// The tests drive the editor through a pseudo-terminal, like a user typing.
+// Execute: go test -v line-editor.go line-editor_test.go
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"syscall"
+	"unicode"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// the error returned when the user presses Ctrl-C
+var errInterrupted = errors.New("interrupted")
+
+/////////////////////////////////
+// Raw Terminal Mode
+/////////////////////////////////
+
+// ioctl() is the system call that reads and changes the settings of a terminal
+func ioctl(fd uintptr, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// a file is a terminal if it has terminal settings (termios)
+func isTerminal(fd uintptr) bool {
+	var t syscall.Termios
+	return ioctl(fd, syscall.TCGETS, unsafe.Pointer(&t)) == nil
+}
+
+// declaring a function that puts the terminal in raw mode and returns the old settings.
+// In the default (cooked) mode the terminal buffers a whole line, echoes it and handles Backspace.
+// In raw mode every key press is delivered immediately and nothing is echoed: the editor does it all.
+func makeRaw(fd uintptr) (*syscall.Termios, error) {
+	var old syscall.Termios
+	if err := ioctl(fd, syscall.TCGETS, unsafe.Pointer(&old)); err != nil {
+		return nil, err
+	}
+	raw := old
+	raw.Iflag &^= syscall.BRKINT | syscall.ICRNL | syscall.INPCK | syscall.ISTRIP | syscall.IXON
+	raw.Oflag &^= syscall.OPOST // \n is not translated to \r\n anymore
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.IEXTEN | syscall.ISIG
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1 // read() returns after 1 byte
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, syscall.TCSETS, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+	return &old, nil
+}
+
+func restoreTerminal(fd uintptr, t *syscall.Termios) error {
+	return ioctl(fd, syscall.TCSETS, unsafe.Pointer(t))
+}
+
+/////////////////////////////////
+// The Line Editor
+/////////////////////////////////
+
+// declaring a struct type for the line editor
+type lineEditor struct {
+	in     *os.File
+	out    io.Writer
+	reader *bufio.Reader
+	tty    bool
+
+	prompt      string
+	history     []string
+	historyPath string // the history is appended to this file, "" to disable
+	maxHistory  int
+
+	// complete returns the possible completions of the text before the cursor
+	complete func(prefix string) []string
+
+	// the state of the line being edited
+	line     []rune
+	pos      int // the cursor position in line
+	lastTab  bool
+	scanner  *bufio.Scanner // used when in is not a terminal
+	histPos  int            // the history entry shown, len(history) is the line being edited
+	histSave []rune         // the line being edited, saved while browsing the history
+}
+
+// declaring a function that creates an editor and loads the history file
+func newLineEditor(in *os.File, out io.Writer, prompt, historyPath string) (*lineEditor, error) {
+	e := &lineEditor{
+		in:          in,
+		out:         out,
+		reader:      bufio.NewReader(in),
+		tty:         isTerminal(in.Fd()),
+		prompt:      prompt,
+		historyPath: historyPath,
+		maxHistory:  1000,
+	}
+	if !e.tty {
+		e.scanner = bufio.NewScanner(in)
+	}
+	if historyPath == "" {
+		return e, nil
+	}
+
+	file, err := os.Open(historyPath)
+	if os.IsNotExist(err) {
+		return e, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		e.history = append(e.history, scanner.Text())
+	}
+	if len(e.history) > e.maxHistory {
+		e.history = e.history[len(e.history)-e.maxHistory:]
+	}
+	return e, scanner.Err()
+}
+
+// method that adds a line to the history and appends it to the history file
+func (e *lineEditor) addHistory(line string) error {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return nil
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > e.maxHistory {
+		e.history = e.history[1:]
+	}
+	if e.historyPath == "" {
+		return nil
+	}
+	file, err := os.OpenFile(e.historyPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = fmt.Fprintln(file, line)
+	return err
+}
+
+// ReadLine method reads a line, like scanner.Scan() followed by scanner.Text()
+// it returns io.EOF at the end of the input and errInterrupted on Ctrl-C.
+func (e *lineEditor) ReadLine() (string, error) {
+	// THE FALLBACK: stdin is a file or a pipe
+	if !e.tty {
+		if !e.scanner.Scan() {
+			if err := e.scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", io.EOF
+		}
+		return e.scanner.Text(), nil
+	}
+
+	old, err := makeRaw(e.in.Fd())
+	if err != nil {
+		return "", err
+	}
+	// the terminal settings must be restored, even if the editor returns an error
+	defer restoreTerminal(e.in.Fd(), old)
+
+	e.line, e.pos, e.lastTab = nil, 0, false
+	e.histPos, e.histSave = len(e.history), nil
+	e.refresh()
+
+	line, err := e.edit()
+	fmt.Fprint(e.out, "\r\n")
+	if err != nil {
+		return "", err
+	}
+	return line, e.addHistory(line)
+}
+
+// declaring a function that returns how many columns a rune takes on the terminal (a simple wcwidth()):
+// combining accents take 0 columns, the CJK characters 2 (中 is as wide as two latin letters), the others 1.
+func runeWidth(r rune) int {
+	switch {
+	case unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) || r == 0x200b:
+		return 0
+	case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hangul, r) ||
+		unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) ||
+		(r >= 0x3000 && r <= 0x303f) || // CJK punctuation
+		(r >= 0xff00 && r <= 0xff60) || (r >= 0xffe0 && r <= 0xffe6) || // fullwidth forms
+		(r >= 0x1f300 && r <= 0x1faff): // emoji
+		return 2
+	}
+	return 1
+}
+
+func stringWidth(runes []rune) int {
+	width := 0
+	for _, r := range runes {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// method that redraws the line: go to column 0, write the prompt and the line,
+// clear to the end of the screen line (ESC[K) and put the cursor back in place (ESC[nC moves right n columns).
+// The cursor moves by columns, not by runes: "中文" is 2 runes but 4 columns.
+func (e *lineEditor) refresh() {
+	var b strings.Builder
+	b.WriteString("\r")
+	b.WriteString(e.prompt)
+	b.WriteString(string(e.line))
+	b.WriteString("\x1b[K\r")
+	if col := stringWidth([]rune(e.prompt)) + stringWidth(e.line[:e.pos]); col > 0 {
+		fmt.Fprintf(&b, "\x1b[%dC", col)
+	}
+	io.WriteString(e.out, b.String())
+}
+
+// the control keys send the letter's code minus 64: Ctrl-A is 1, Ctrl-B is 2, ...
+func ctrl(c byte) rune { return rune(c & 0x1f) }
+
+// method that handles the key presses until Enter
+func (e *lineEditor) edit() (string, error) {
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		tab := false
+
+		switch r {
+		case '\r', '\n':
+			return string(e.line), nil
+		case ctrl('C'):
+			return "", errInterrupted
+		case ctrl('D'):
+			if len(e.line) == 0 {
+				return "", io.EOF
+			}
+			e.deleteAt(e.pos)
+		case 127, ctrl('H'): // Backspace
+			if e.pos > 0 {
+				e.pos--
+				e.deleteAt(e.pos)
+			}
+		case ctrl('A'):
+			e.pos = 0
+		case ctrl('E'):
+			e.pos = len(e.line)
+		case ctrl('B'):
+			e.moveCursor(-1)
+		case ctrl('F'):
+			e.moveCursor(1)
+		case ctrl('P'):
+			e.browseHistory(-1)
+		case ctrl('N'):
+			e.browseHistory(1)
+		case ctrl('U'):
+			e.line, e.pos = append([]rune(nil), e.line[e.pos:]...), 0
+		case ctrl('K'):
+			e.line = e.line[:e.pos]
+		case ctrl('W'):
+			e.deleteWord()
+		case ctrl('L'):
+			io.WriteString(e.out, "\x1b[H\x1b[2J") // clearing the screen
+		case ctrl('R'):
+			line, accept, err := e.search()
+			if err != nil {
+				return "", err
+			}
+			if accept {
+				return line, nil
+			}
+		case '\t':
+			tab = true
+			e.completeLine()
+		case 0x1b: // ESC starts an escape sequence sent by the arrow keys
+			e.escape()
+		default:
+			if unicode.IsPrint(r) {
+				e.line = append(e.line[:e.pos], append([]rune{r}, e.line[e.pos:]...)...)
+				e.pos++
+			}
+		}
+		e.lastTab = tab
+		e.refresh()
+	}
+}
+
+// method that reads an escape sequence: ESC [ A is Up, ESC [ 3 ~ is Delete, ...
+func (e *lineEditor) escape() {
+	b, err := e.reader.ReadByte()
+	if err != nil || (b != '[' && b != 'O') {
+		return
+	}
+	seq := []byte{}
+	for {
+		c, err := e.reader.ReadByte()
+		if err != nil {
+			return
+		}
+		seq = append(seq, c)
+		if c >= 0x40 && c <= 0x7e { // the final byte of the sequence
+			break
+		}
+	}
+	switch string(seq) {
+	case "A":
+		e.browseHistory(-1)
+	case "B":
+		e.browseHistory(1)
+	case "C":
+		e.moveCursor(1)
+	case "D":
+		e.moveCursor(-1)
+	case "H", "1~", "7~":
+		e.pos = 0
+	case "F", "4~", "8~":
+		e.pos = len(e.line)
+	case "3~":
+		e.deleteAt(e.pos)
+	}
+}
+
+func (e *lineEditor) moveCursor(n int) {
+	if p := e.pos + n; p >= 0 && p <= len(e.line) {
+		e.pos = p
+	}
+}
+
+func (e *lineEditor) deleteAt(i int) {
+	if i < len(e.line) {
+		e.line = append(e.line[:i], e.line[i+1:]...)
+	}
+}
+
+// method that deletes the word before the cursor (and the spaces after it)
+func (e *lineEditor) deleteWord() {
+	start := e.pos
+	for start > 0 && e.line[start-1] == ' ' {
+		start--
+	}
+	for start > 0 && e.line[start-1] != ' ' {
+		start--
+	}
+	e.line = append(e.line[:start], e.line[e.pos:]...)
+	e.pos = start
+}
+
+// method that replaces the line with an older (-1) or newer (+1) history entry
+func (e *lineEditor) browseHistory(dir int) {
+	p := e.histPos + dir
+	if p < 0 || p > len(e.history) {
+		return
+	}
+	if e.histPos == len(e.history) {
+		e.histSave = e.line // saving the line being edited
+	}
+	e.histPos = p
+	if p == len(e.history) {
+		e.line = e.histSave
+	} else {
+		e.line = []rune(e.history[p])
+	}
+	e.pos = len(e.line)
+}
+
+// method that handles Tab: a single completion replaces the text before the cursor,
+// many completions are extended to their common prefix and listed on the second Tab.
+func (e *lineEditor) completeLine() {
+	if e.complete == nil {
+		return
+	}
+	prefix := string(e.line[:e.pos])
+	candidates := e.complete(prefix)
+	if len(candidates) == 0 {
+		return
+	}
+
+	common := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, common) {
+			// trimming a whole rune: "bär" and "båt" share the byte 0xc3 after the "b", but not a rune
+			_, size := utf8.DecodeLastRuneInString(common)
+			common = common[:len(common)-size]
+		}
+	}
+	if len(candidates) == 1 {
+		common += " "
+	}
+	if len(common) > len(prefix) {
+		rest := e.line[e.pos:]
+		e.line = append([]rune(common), rest...)
+		e.pos = utf8.RuneCountInString(common)
+		return
+	}
+	if e.lastTab {
+		fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	}
+}
+
+// method that handles Ctrl-R (reverse incremental search)
+// Enter runs the found line (accept is true), Ctrl-G or ESC cancel, other keys keep the found line for editing.
+// When nothing older matches, the last match stays on the screen, like in bash.
+func (e *lineEditor) search() (line string, accept bool, err error) {
+	var query []rune
+	match := len(e.history) // the index of the history entry that matches the query
+	failing := false
+
+	// searching backwards from the entry before `from`; match changes only if an entry is found
+	find := func(from int) {
+		for i := from - 1; i >= 0; i-- {
+			if strings.Contains(e.history[i], string(query)) {
+				match, failing = i, false
+				return
+			}
+		}
+		failing = true
+	}
+	found := func() string {
+		if match < len(e.history) {
+			return e.history[match]
+		}
+		return string(e.line) // nothing found yet: the line being edited
+	}
+
+	for {
+		prefix := ""
+		if failing {
+			prefix = "failing "
+		}
+		fmt.Fprintf(e.out, "\r(%sreverse-i-search)`%s': %s\x1b[K", prefix, string(query), found())
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return "", false, err
+		}
+		switch {
+		case r == ctrl('R'):
+			find(match) // the next older match
+		case r == 127 || r == ctrl('H'):
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				match, failing = len(e.history), false
+				find(match)
+			}
+		case r == '\r' || r == '\n':
+			return found(), true, nil
+		case r == ctrl('G') || r == 0x1b:
+			return "", false, nil
+		case r == ctrl('C'):
+			return "", false, errInterrupted
+		case unicode.IsPrint(r):
+			query = append(query, r)
+			find(min(match+1, len(e.history))) // the current match may still match the longer query
+		default:
+			e.line = []rune(found())
+			e.pos = len(e.line)
+			return "", false, nil
+		}
+	}
+}
+
+func main() {
+	commands := []string{"exit", "hello", "help", "history"}
+	complete := func(prefix string) []string {
+		var matches []string
+		for _, c := range commands {
+			if strings.HasPrefix(c, prefix) {
+				matches = append(matches, c)
+			}
+		}
+		return matches
+	}
+
+	home, _ := os.UserHomeDir()
+	e, err := newLineEditor(os.Stdin, os.Stdout, "> ", home+"/.line_editor_history")
+	if err != nil {
+		log.Fatal(err)
+	}
+	e.complete = complete
+
+	// reading the input continuously until a specific string is entered, like in files.go
+	for {
+		text, err := e.ReadLine()
+		if err == io.EOF || err == errInterrupted {
+			break
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if text == "history" {
+			for i, h := range e.history {
+				fmt.Printf("%5d  %s\n", i+1, h)
+			}
+			continue
+		}
+		fmt.Println("You entered:", text)
+		if text == "exit" {
+			fmt.Println("Exiting the scanning ...")
+			break
+		}
+	}
+}
@@ -0,0 +1,164 @@
+/////////////////////////////////
+// Tests: Driving the Editor Through a Pseudo-Terminal
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Execute: go test -v line-editor.go line-editor_test.go
+
+// A pseudo-terminal is a pair of files: a program uses the slave (/dev/pts/N) as its terminal
+// and the master (/dev/ptmx) plays the user: what's written to it looks like key presses.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// declaring a function that opens a new pseudo-terminal
+func openPty() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var unlock int32
+	if err := ioctl(master.Fd(), syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	var n uint32
+	if err := ioctl(master.Fd(), syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// declaring a function that returns an editor using the slave side of a new pty, and the master side
+func newPtyEditor(t *testing.T, history ...string) (*lineEditor, *os.File) {
+	t.Helper()
+	master, slave, err := openPty()
+	if err != nil {
+		t.Skip("no pseudo-terminal:", err)
+	}
+	t.Cleanup(func() {
+		slave.Close()
+		master.Close()
+	})
+	// raw mode from the start: in cooked mode the terminal itself would handle the keys typed
+	// before ReadLine() is called (Backspace, Ctrl-W, Ctrl-R reprint the line...)
+	if _, err := makeRaw(slave.Fd()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the terminal output must be read, otherwise the editor blocks when the buffer is full
+	go io.Copy(io.Discard, master)
+
+	e, err := newLineEditor(slave, slave, "> ", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.tty {
+		t.Fatal("the slave side of the pty is not a terminal")
+	}
+	e.history = history
+	commands := []string{"bär", "båt", "exit", "hello", "help", "history"}
+	e.complete = func(prefix string) []string {
+		var matches []string
+		for _, c := range commands {
+			if strings.HasPrefix(c, prefix) {
+				matches = append(matches, c)
+			}
+		}
+		return matches
+	}
+	return e, master
+}
+
+// a helper function that types keys and returns the line read by the editor
+func typeLine(t *testing.T, e *lineEditor, master *os.File, keys string) string {
+	t.Helper()
+	if _, err := io.WriteString(master, keys); err != nil {
+		t.Fatal(err)
+	}
+	line, err := e.ReadLine()
+	if err != nil {
+		t.Fatalf("ReadLine() after %q: %v", keys, err)
+	}
+	return line
+}
+
+func TestEditing(t *testing.T) {
+	e, master := newPtyEditor(t)
+	tests := []struct {
+		name, keys, want string
+	}{
+		{"typing", "hello world\r", "hello world"},
+		{"moving left and inserting", "wrld\x1b[D\x1b[D\x1b[D\x1b[Do\r", "owrld"},
+		{"Tab completion", "hist\t\r", "history "},
+		{"Up twice", "\x1b[A\x1b[A\r", "owrld"},
+		{"Ctrl-U", "bye\x15exit\r", "exit"},
+		{"Ctrl-W", "one two\x17three\r", "one three"},
+		{"Backspace on runes", "中文x\x7f\x7f\r", "中"},
+		{"Tab completion to a common rune prefix", "b\t\r", "b"},
+	}
+	for _, tt := range tests {
+		if got := typeLine(t, e, master, tt.keys); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReverseSearch(t *testing.T) {
+	tests := []struct {
+		name, keys, want string
+	}{
+		{"newest match", "\x12hel\r", "help"},
+		{"Ctrl-R again: the next older match", "\x12hel\x12\r", "hello world"},
+		{"no older match: keeps the last one", "\x12hel\x12\x12\x12\r", "hello world"},
+		{"longer query that doesn't match", "\x12hez\r", "help"},
+		{"query that never matches: the edited line", "abc\x12zzz\r", "abc"},
+		{"Ctrl-G cancels", "abc\x12hel\x07\r", "abc"},
+		{"another key edits the match", "\x12exit\x05!\r", "exit!"},
+	}
+	for _, tt := range tests {
+		// a new editor for each case, so the history doesn't grow
+		e, master := newPtyEditor(t, "hello world", "exit", "help")
+		if got := typeLine(t, e, master, tt.keys); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRefreshCursorColumns(t *testing.T) {
+	tests := []struct {
+		line    string
+		pos     int
+		wantCol int
+	}{
+		{"abc", 3, 5},
+		{"中文", 1, 4},    // "> " is 2 columns, 中 is 2 more
+		{"中文", 2, 6},    // not 4: every CJK character takes 2 columns
+		{"café", 5, 6}, // the combining accent takes no column
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := &lineEditor{out: &out, prompt: "> ", line: []rune(tt.line), pos: tt.pos}
+		e.refresh()
+		want := fmt.Sprintf("\r\x1b[%dC", tt.wantCol)
+		if !strings.HasSuffix(out.String(), want) {
+			t.Errorf("%q at %d: output %q doesn't end with %q", tt.line, tt.pos, out.String(), want)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+/////////////////////////////////
+// Reading Large Files with Memory Mapping (syscall.Mmap)
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+// It uses Linux system calls (syscall.Mmap and syscall.Munmap).
+// Execute: go run mmap-reader.go
+// The benchmarks compare mmap with os.ReadFile and bufio.Scanner, on a 4 GB file for example:
+// Execute: MMAP_BENCH_MB=4096 go test -bench . -benchmem mmap-reader.go mmap-reader_test.go
+
+// ioutil.ReadFile() copies the whole file into a byte slice on the heap.
+// A memory mapped file is not copied: the kernel maps the file's pages into the address space
+// of the process and loads them from disk (the page cache) only when they are accessed.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// declaring a struct type for a read-only mapping of a file
+type mmapFile struct {
+	mu   sync.RWMutex // Remap() replaces data while readers may be using it
+	file *os.File
+	data []byte // the mapped memory, it's not on the Go heap
+}
+
+// declaring a function that opens and maps a file
+func openMmap(path string) (*mmapFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &mmapFile{file: file}
+	if err := m.mapFile(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// method that maps the file with its current size
+func (m *mmapFile) mapFile() error {
+	fileInfo, err := m.file.Stat()
+	if err != nil {
+		return err
+	}
+	size := fileInfo.Size()
+	if size == 0 {
+		m.data = nil // mmap() fails for a length of 0
+		return nil
+	}
+	if int64(int(size)) != size {
+		return errors.New("file too large to map")
+	}
+	data, err := syscall.Mmap(int(m.file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	m.data = data
+	return nil
+}
+
+// the error returned when a page of the mapping is not backed by the file anymore
+var errShrunk = errors.New("mmap: the file shrank while it was mapped")
+
+// Accessing a page beyond the end of a file that was truncated raises SIGBUS, which kills the program.
+// (the rest of the page that contains the new end of the file reads as zeros, it doesn't fault)
+// debug.SetPanicOnFault(true) turns it into a panic of the current goroutine, that we recover as an error.
+func catchFault(fn func()) (err error) {
+	old := debug.SetPanicOnFault(true)
+	defer func() {
+		debug.SetPanicOnFault(old)
+		if r := recover(); r != nil {
+			if _, ok := r.(interface{ Addr() uintptr }); ok { // the panic of a memory fault
+				err = errShrunk
+				return
+			}
+			panic(r) // another panic, from fn
+		}
+	}()
+	fn()
+	return nil
+}
+
+// View method calls fn with the mapped file as a byte slice, without copying it.
+// The slice is valid only during the call: fn must not keep it, Remap() may unmap it afterwards.
+// If the file shrinks during the call, it's mapped again and errShrunk is returned.
+func (m *mmapFile) View(fn func(data []byte)) error {
+	err := m.view(fn)
+	if err != nil {
+		if _, rerr := m.Remap(); rerr != nil {
+			return rerr
+		}
+	}
+	return err
+}
+
+// method that calls fn with the read lock held
+// the unlock is deferred: the lock is released even if fn panics with something other than a memory fault.
+func (m *mmapFile) view(fn func(data []byte)) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return catchFault(func() { fn(m.data) })
+}
+
+// Remap method maps the file again if its size changed since it was mapped.
+func (m *mmapFile) Remap() (changed bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fileInfo, err := m.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if fileInfo.Size() == int64(len(m.data)) {
+		return false, nil
+	}
+	if m.data != nil {
+		if err := syscall.Munmap(m.data); err != nil {
+			return false, err
+		}
+		m.data = nil
+	}
+	return true, m.mapFile()
+}
+
+// Len method returns the size of the mapping
+func (m *mmapFile) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.data)
+}
+
+// ReadAt method makes *mmapFile an io.ReaderAt
+// it copies into p, like every io.ReaderAt does, but only the requested bytes.
+// When the read hits the end of the mapping, the file may have grown or shrunk: it's mapped again and read once more.
+func (m *mmapFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	n, err := m.readAt(p, off)
+	if err == nil {
+		return n, nil
+	}
+	changed, rerr := m.Remap()
+	if rerr != nil {
+		return 0, rerr
+	}
+	if changed {
+		return m.readAt(p, off)
+	}
+	return n, err
+}
+
+func (m *mmapFile) readAt(p []byte, off int64) (n int, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	if ferr := catchFault(func() { n = copy(p, m.data[off:]) }); ferr != nil {
+		return 0, ferr
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Lines method calls fn for every line in the file.
+// the line is a sub-slice of the mapped memory (no copy), so fn must not keep it after returning.
+// fn returns false to stop the iteration.
+func (m *mmapFile) Lines(fn func(line []byte) bool) error {
+	return m.View(func(data []byte) {
+		for len(data) > 0 {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				fn(data) // the last line has no trailing \n
+				return
+			}
+			if !fn(data[:i]) {
+				return
+			}
+			data = data[i+1:]
+		}
+	})
+}
+
+// Close method unmaps the memory and closes the file
+func (m *mmapFile) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var err error
+	if m.data != nil {
+		err = syscall.Munmap(m.data)
+		m.data = nil
+	}
+	if cerr := m.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+/////////////////////////////////
+// Using the Mapping
+/////////////////////////////////
+
+// a helper function that writes a file of about size bytes with numbered lines (mmap-reader_test.go uses it too)
+func writeTestFile(path string, size int64) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	bufferedWriter := bufio.NewWriterSize(file, 1<<20)
+	var written int64
+	for i := 0; written < size; i++ {
+		n, err := bufferedWriter.WriteString("this is line number " + strconv.Itoa(i) + " of the test file\n")
+		if err != nil {
+			file.Close()
+			return err
+		}
+		written += int64(n)
+	}
+	if err := bufferedWriter.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func main() {
+	dir, err := os.MkdirTemp("", "mmap")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := dir + "/big.txt"
+
+	if err := writeTestFile(path, 1<<20); err != nil {
+		log.Fatal(err)
+	}
+
+	m, err := openMmap(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer m.Close()
+
+	// COUNTING THE LINES WITHOUT COPYING THEM
+	// (mmap-reader_test.go compares it with os.ReadFile and bufio.Scanner)
+	lines := 0
+	if err := m.Lines(func(line []byte) bool {
+		lines++
+		return true
+	}); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Lines:", lines) // => Lines: 24644
+
+	// USING THE MAPPING AS AN io.ReaderAt
+	// io.NewSectionReader() turns an io.ReaderAt into an io.Reader for a part of the file
+	section := io.NewSectionReader(m, 0, 20)
+	first, _ := io.ReadAll(section)
+	fmt.Printf("%q\n", first) // => "this is line number "
+
+	// THE FILE SHRINKS WHILE IT'S MAPPED
+	// the pages after the new end are not backed by the file anymore: reading them is an error, not a crash
+	if err := os.Truncate(path, 100); err != nil {
+		log.Fatal(err)
+	}
+	err = m.View(func(data []byte) {
+		fmt.Println("Mapped size:", len(data)) // => Mapped size: 1048582
+		fmt.Println(data[len(data)-1])         // SIGBUS
+	})
+	fmt.Println(err)                  // => mmap: the file shrank while it was mapped
+	fmt.Println("New size:", m.Len()) // => New size: 100
+
+	// THE FILE GROWS: ReadAt() maps it again when it reaches the end of the mapping
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	file.WriteString("appended\n")
+	file.Close()
+	tail := make([]byte, 9)
+	n, err := m.ReadAt(tail, 100)
+	fmt.Printf("%q %v, new size: %d\n", tail[:n], err, m.Len()) // => "appended\n" <nil>, new size: 109
+}
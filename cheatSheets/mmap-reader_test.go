@@ -0,0 +1,231 @@
+/////////////////////////////////
+// Benchmarks: mmap vs os.ReadFile vs bufio.Scanner
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// The size of the file is set by MMAP_BENCH_MB (default 256 MB). Use a size larger than the RAM
+// to see os.ReadFile fail or swap while mmap and bufio.Scanner keep working.
+// Execute: MMAP_BENCH_MB=4096 go test -bench . -benchmem mmap-reader.go mmap-reader_test.go
+
+// with MMAP_BENCH_MB=2048 -benchtime 2x on a machine with 1 CPU and 5 GB of RAM:
+// => BenchmarkReadFile 	       2	2096162761 ns/op	1024.48 MB/s	2147492200 B/op	       5 allocs/op
+// => BenchmarkScanner  	       2	2496872598 ns/op	 860.07 MB/s	    4248 B/op	       4 allocs/op
+// => BenchmarkMmap     	       2	 886502434 ns/op	2422.42 MB/s	     424 B/op	       5 allocs/op
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+var (
+	benchOnce sync.Once
+	benchPath string
+	benchSize int64
+	benchErr  error
+	benchDir  string
+)
+
+// TestMain removes the benchmark file after all the tests and benchmarks
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if benchDir != "" {
+		os.RemoveAll(benchDir)
+	}
+	os.Exit(code)
+}
+
+// a helper function that writes the benchmark file once, it's shared by all the benchmarks
+func benchFile(b *testing.B) string {
+	b.Helper()
+	benchOnce.Do(func() {
+		sizeMB := int64(256)
+		if s := os.Getenv("MMAP_BENCH_MB"); s != "" {
+			sizeMB, benchErr = strconv.ParseInt(s, 10, 64)
+			if benchErr != nil {
+				return
+			}
+		}
+		benchDir, benchErr = os.MkdirTemp("", "mmap-bench")
+		if benchErr != nil {
+			return
+		}
+		benchPath = filepath.Join(benchDir, "big.txt")
+		if benchErr = writeTestFile(benchPath, sizeMB<<20); benchErr != nil {
+			return
+		}
+		var fileInfo os.FileInfo
+		fileInfo, benchErr = os.Stat(benchPath)
+		if benchErr == nil {
+			benchSize = fileInfo.Size()
+		}
+	})
+	if benchErr != nil {
+		b.Fatal(benchErr)
+	}
+	b.SetBytes(benchSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+	return benchPath
+}
+
+// os.ReadFile() loads the whole file into memory
+func BenchmarkReadFile(b *testing.B) {
+	path := benchFile(b)
+	for i := 0; i < b.N; i++ {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		bytes.Count(data, []byte{'\n'})
+	}
+}
+
+// bufio.Scanner reads the file in small chunks, but every chunk is copied from the kernel
+func BenchmarkScanner(b *testing.B) {
+	path := benchFile(b)
+	for i := 0; i < b.N; i++ {
+		file, err := os.Open(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// mmap: no copy and almost no heap allocation
+func BenchmarkMmap(b *testing.B) {
+	path := benchFile(b)
+	for i := 0; i < b.N; i++ {
+		m, err := openMmap(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := m.Lines(func(line []byte) bool { return true }); err != nil {
+			b.Fatal(err)
+		}
+		m.Close()
+	}
+}
+
+// a helper function that maps a small file for the tests
+func mapTestFile(t *testing.T) (*mmapFile, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "small.txt")
+	if err := writeTestFile(path, 64<<10); err != nil {
+		t.Fatal(err)
+	}
+	m, err := openMmap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m, path
+}
+
+func TestLinesMatchScanner(t *testing.T) {
+	m, path := mapTestFile(t)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bytes.Split(bytes.TrimSuffix(data, []byte{'\n'}), []byte{'\n'})
+	i := 0
+	err = m.Lines(func(line []byte) bool {
+		if i >= len(want) || !bytes.Equal(line, want[i]) {
+			t.Fatalf("line %d: got %q", i, line)
+		}
+		i++
+		return true
+	})
+	if err != nil || i != len(want) {
+		t.Errorf("Lines() = %v after %d lines, want nil after %d", err, i, len(want))
+	}
+}
+
+func TestShrinkWhileMapped(t *testing.T) {
+	m, path := mapTestFile(t)
+	size := m.Len()
+	if err := os.Truncate(path, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	// without the fault handler, this access would kill the test binary with SIGBUS
+	var last byte
+	err := m.View(func(data []byte) {
+		last = data[size-1]
+	})
+	if err != errShrunk {
+		t.Fatalf("View() = %v (read %q), want %v", err, last, errShrunk)
+	}
+	if m.Len() != 100 {
+		t.Errorf("Len() = %d after the remap, want 100", m.Len())
+	}
+
+}
+
+func TestReadAtAfterShrink(t *testing.T) {
+	m, path := mapTestFile(t)
+	if err := os.Truncate(path, 100); err != nil {
+		t.Fatal(err)
+	}
+	// the page at 8192 is not backed by the file anymore: ReadAt() gets the fault, remaps and reads again
+	n, err := m.ReadAt(make([]byte, 80), 8192)
+	if n != 0 || err != io.EOF {
+		t.Errorf("ReadAt() = %d, %v; want 0, EOF", n, err)
+	}
+	if m.Len() != 100 {
+		t.Errorf("Len() = %d after the remap, want 100", m.Len())
+	}
+}
+
+func TestGrowWhileMapped(t *testing.T) {
+	m, path := mapTestFile(t)
+	size := int64(m.Len())
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString("appended\n"); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	p := make([]byte, 9)
+	n, err := m.ReadAt(p, size)
+	if err != nil || string(p[:n]) != "appended\n" {
+		t.Errorf("ReadAt() = %q, %v; want %q, nil", p[:n], err, "appended\n")
+	}
+}
+
+func TestViewPanicReleasesLock(t *testing.T) {
+	m, _ := mapTestFile(t)
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("recover() = %v, want the panic of fn", r)
+			}
+		}()
+		m.View(func(data []byte) { panic("boom") })
+	}()
+
+	// Remap() and Close() take the write lock: they would block forever if View() had kept the read lock
+	if !m.mu.TryLock() {
+		m.mu.RUnlock() // releasing the leaked lock so that the cleanup can close the file
+		t.Fatal("the read lock was not released after the panic")
+	}
+	m.mu.Unlock()
+}
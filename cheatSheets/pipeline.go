@@ -0,0 +1,322 @@
+/////////////////////////////////
+// Channel Pipelines with Cancellation
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+// Execute: go run pipeline.go
+// The tests check that no stage leaks a goroutine:
+// Execute: go test -v pipeline.go pipeline_test.go
+
+// A pipeline is a series of stages connected by channels.
+// Every stage is a goroutine that receives values from an input channel, processes them and sends them to an output channel.
+// The rules that keep a pipeline correct:
+// 1. a stage closes its output channel when it's done (the only owner of a channel closes it)
+// 2. every send and receive also selects on ctx.Done(): a stage blocked on a send would leak forever
+//    if the consumer stopped reading, and one blocked on a receive if the producer stopped sending
+//    (`for v := range in` is not enough)
+// 3. a consumer that stops early cancels the context: `defer cancel()` stops ALL the stages
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+/////////////////////////////////
+// Stages
+/////////////////////////////////
+
+// a helper function that sends v unless the context is cancelled first
+func send[T any](ctx context.Context, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// a helper function that receives a value unless the context is cancelled first; ok is false after both
+func recv[T any](ctx context.Context, in <-chan T) (v T, ok bool) {
+	select {
+	case v, ok = <-in:
+		return v, ok
+	case <-ctx.Done():
+		return v, false
+	}
+}
+
+// declaring a function that sends next(0), next(1), ... until next returns false (an infinite stream if it never does)
+func generate[T any](ctx context.Context, next func(i int) (T, bool)) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for i := 0; ; i++ {
+			v, ok := next(i)
+			if !ok || !send(ctx, out, v) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// declaring a function that sends the values of a slice
+func fromSlice[T any](ctx context.Context, values []T) <-chan T {
+	return generate(ctx, func(i int) (T, bool) {
+		if i == len(values) {
+			var zero T
+			return zero, false
+		}
+		return values[i], true
+	})
+}
+
+// declaring a function that sends fn(v) for every v received
+func mapValues[T, R any](ctx context.Context, in <-chan T, fn func(T) R) <-chan R {
+	out := make(chan R)
+	go func() {
+		defer close(out)
+		for {
+			v, ok := recv(ctx, in)
+			if !ok || !send(ctx, out, fn(v)) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// declaring a function that sends only the values for which keep returns true
+func filter[T any](ctx context.Context, in <-chan T, keep func(T) bool) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for {
+			v, ok := recv(ctx, in)
+			if !ok || keep(v) && !send(ctx, out, v) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// declaring a function that sends the first n values and stops.
+// The stages before take() are blocked until the context is cancelled: the consumer must cancel it.
+func take[T any](ctx context.Context, in <-chan T, n int) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for i := 0; i < n; i++ {
+			v, ok := recv(ctx, in)
+			if !ok || !send(ctx, out, v) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// declaring a function that splits a channel between n channels: every value goes to one of them (the first one ready).
+// Each output is usually followed by a slow stage (Map), so n values are processed at the same time.
+func fanOut[T any](ctx context.Context, in <-chan T, n int) []<-chan T {
+	outs := make([]<-chan T, n)
+	for i := range outs {
+		out := make(chan T)
+		outs[i] = out
+		go func() {
+			defer close(out)
+			for { // n goroutines receiving from the same channel
+				v, ok := recv(ctx, in)
+				if !ok || !send(ctx, out, v) {
+					return
+				}
+			}
+		}()
+	}
+	return outs
+}
+
+// declaring a function that merges many channels into one; the output is closed when all the inputs are closed
+func fanIn[T any](ctx context.Context, ins ...<-chan T) <-chan T {
+	out := make(chan T)
+	var wg sync.WaitGroup
+	wg.Add(len(ins))
+	for _, in := range ins {
+		go func() {
+			defer wg.Done()
+			for {
+				v, ok := recv(ctx, in)
+				if !ok || !send(ctx, out, v) {
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// declaring a function that groups the values in slices of size values.
+// A batch that is not full is sent anyway after maxWait, so slow inputs don't wait forever.
+func batch[T any](ctx context.Context, in <-chan T, size int, maxWait time.Duration) <-chan []T {
+	out := make(chan []T)
+	go func() {
+		defer close(out)
+		var batch []T
+		timer := time.NewTimer(maxWait)
+		timer.Stop()
+		defer timer.Stop()
+		flush := func() bool {
+			timer.Stop()
+			if len(batch) == 0 {
+				return true
+			}
+			ok := send(ctx, out, batch)
+			batch = nil // a new slice: the consumer owns the one that was sent
+			return ok
+		}
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					flush()
+					return
+				}
+				batch = append(batch, v)
+				if len(batch) == 1 {
+					timer.Reset(maxWait)
+				}
+				if len(batch) == size && !flush() {
+					return
+				}
+			case <-timer.C:
+				if !flush() {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// declaring a function that copies every value to two channels.
+// Both outputs must be read: the slower consumer sets the speed of both.
+func tee[T any](ctx context.Context, in <-chan T) (<-chan T, <-chan T) {
+	out1, out2 := make(chan T), make(chan T)
+	go func() {
+		defer close(out1)
+		defer close(out2)
+		for {
+			v, ok := recv(ctx, in)
+			if !ok {
+				return
+			}
+			// sending to the two channels in any order: a nil channel is never selected
+			o1, o2 := out1, out2
+			for o1 != nil || o2 != nil {
+				select {
+				case o1 <- v:
+					o1 = nil
+				case o2 <- v:
+					o2 = nil
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out1, out2
+}
+
+func main() {
+	square := func(n int) int { return n * n }
+	even := func(n int) bool { return n%2 == 0 }
+	naturals := func(i int) (int, bool) { return i + 1, true } // 1, 2, 3, ... forever
+
+	// MAP, FILTER AND TAKE
+	ctx, cancel := context.WithCancel(context.Background())
+	for v := range take(ctx, filter(ctx, mapValues(ctx, generate(ctx, naturals), square), even), 5) {
+		fmt.Print(v, " ")
+	}
+	fmt.Println() // => 4 16 36 64 100
+	cancel()      // stops the infinite generator after take()
+
+	// FAN-OUT AND FAN-IN: 4 slow workers in parallel
+	ctx, cancel = context.WithCancel(context.Background())
+	slowSquare := func(n int) int {
+		time.Sleep(50 * time.Millisecond)
+		return n * n
+	}
+	start := time.Now()
+	ins := fanOut(ctx, fromSlice(ctx, []int{1, 2, 3, 4, 5, 6, 7, 8}), 4)
+	workers := make([]<-chan int, len(ins))
+	for i, in := range ins {
+		workers[i] = mapValues(ctx, in, slowSquare)
+	}
+	sum := 0
+	for v := range fanIn(ctx, workers...) { // the order of the values is not the order of the input
+		sum += v
+	}
+	fmt.Println("sum:", sum, "in", time.Since(start).Round(50*time.Millisecond)) // => sum: 204 in 100ms (not 400ms)
+	cancel()
+
+	// BATCH: groups of 3, or less after 100ms
+	ctx, cancel = context.WithCancel(context.Background())
+	words := generate(ctx, func(i int) (string, bool) {
+		if i == 4 {
+			time.Sleep(200 * time.Millisecond) // a slow input: the batch [d] is sent by the timer
+		}
+		return strings.Split("a b c d e f g", " ")[i], i < 6
+	})
+	for b := range batch(ctx, words, 3, 100*time.Millisecond) {
+		fmt.Print(b, " ")
+	}
+	fmt.Println() // => [a b c] [d] [e f]
+	cancel()
+
+	// TEE: the same values to two consumers
+	ctx, cancel = context.WithCancel(context.Background())
+	a, b := tee(ctx, fromSlice(ctx, []int{1, 2, 3}))
+	var wg sync.WaitGroup
+	var total, count int
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for v := range a {
+			total += v
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range b {
+			count++
+		}
+	}()
+	wg.Wait()
+	fmt.Println("sum:", total, "count:", count) // => sum: 6 count: 3
+	cancel()
+
+	// THE CONSUMER STOPS EARLY WITHOUT CANCELLING: every stage stays blocked on a send
+	// (pipeline_test.go checks every stage like this with runtime.NumGoroutine())
+	time.Sleep(100 * time.Millisecond) // the goroutines of the cancelled pipelines are returning
+	ctx, cancel = context.WithCancel(context.Background())
+	out := mapValues(ctx, generate(ctx, naturals), square)
+	fmt.Println(<-out, <-out)                          // => 1 4
+	fmt.Println("goroutines:", runtime.NumGoroutine()) // => goroutines: 3
+	cancel()                                           // cancelling the context releases them
+	time.Sleep(100 * time.Millisecond)
+	fmt.Println("after cancel():", runtime.NumGoroutine()) // => after cancel(): 1
+}
@@ -0,0 +1,159 @@
+/////////////////////////////////
+// Tests: Pipelines That Don't Leak Goroutines
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Execute: go test -v pipeline.go pipeline_test.go
+
+// runtime.NumGoroutine() is compared before and after each test, like go-routines-waitgroups.go prints it.
+// The tests don't run in parallel, so the count is not changed by another test.
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+)
+
+// a helper function that fails the test if it leaves goroutines behind: defer checkLeaks(t)()
+// Goroutines that are returning need a little time, so it retries for a second.
+func checkLeaks(t *testing.T) func() {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	return func() {
+		t.Helper()
+		after := runtime.NumGoroutine()
+		for i := 0; i < 100 && after > before; i++ {
+			time.Sleep(10 * time.Millisecond)
+			after = runtime.NumGoroutine()
+		}
+		if after > before {
+			t.Errorf("leak: %d goroutines before, %d after", before, after)
+		}
+	}
+}
+
+// a helper function that receives all the values of a channel
+func collect[T any](in <-chan T) []T {
+	var values []T
+	for v := range in {
+		values = append(values, v)
+	}
+	return values
+}
+
+func TestMapFilterTake(t *testing.T) {
+	defer checkLeaks(t)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel() // stops the infinite generator after take()
+
+	naturals := func(i int) (int, bool) { return i + 1, true }
+	square := func(n int) int { return n * n }
+	even := func(n int) bool { return n%2 == 0 }
+	got := collect(take(ctx, filter(ctx, mapValues(ctx, generate(ctx, naturals), square), even), 5))
+	if want := []int{4, 16, 36, 64, 100}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFanOutFanIn(t *testing.T) {
+	defer checkLeaks(t)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ins := fanOut(ctx, fromSlice(ctx, []int{1, 2, 3, 4, 5, 6, 7, 8}), 4)
+	workers := make([]<-chan int, len(ins))
+	for i, in := range ins {
+		workers[i] = mapValues(ctx, in, func(n int) int { return n * n })
+	}
+	got := collect(fanIn(ctx, workers...))
+	sort.Ints(got) // the order of the values is not the order of the input
+	if want := []int{1, 4, 9, 16, 25, 36, 49, 64}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	defer checkLeaks(t)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	words := generate(ctx, func(i int) (string, bool) {
+		if i == 4 {
+			time.Sleep(200 * time.Millisecond) // a slow input: the batch [d] is sent by the timer
+		}
+		return []string{"a", "b", "c", "d", "e", "f", "g"}[i], i < 6
+	})
+	got := collect(batch(ctx, words, 3, 100*time.Millisecond))
+	if want := [][]string{{"a", "b", "c"}, {"d"}, {"e", "f"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestTee(t *testing.T) {
+	defer checkLeaks(t)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a, b := tee(ctx, fromSlice(ctx, []int{1, 2, 3}))
+	done := make(chan []int)
+	go func() { done <- collect(a) }()
+	gotB := collect(b)
+	gotA := <-done
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(gotA, want) || !reflect.DeepEqual(gotB, want) {
+		t.Errorf("got %v and %v, want %v twice", gotA, gotB, want)
+	}
+}
+
+// every stage must return when the context is cancelled, even if its input is never closed
+// and its output is never read
+func TestStagesReturnOnCancel(t *testing.T) {
+	stages := map[string]func(ctx context.Context, in <-chan int){
+		"mapValues": func(ctx context.Context, in <-chan int) { mapValues(ctx, in, func(n int) int { return n }) },
+		"filter":    func(ctx context.Context, in <-chan int) { filter(ctx, in, func(int) bool { return true }) },
+		"take":      func(ctx context.Context, in <-chan int) { take(ctx, in, 10) },
+		"fanOut":    func(ctx context.Context, in <-chan int) { fanOut(ctx, in, 3) },
+		"fanIn":     func(ctx context.Context, in <-chan int) { fanIn(ctx, in, in) },
+		"batch":     func(ctx context.Context, in <-chan int) { batch(ctx, in, 10, time.Hour) },
+		"tee":       func(ctx context.Context, in <-chan int) { tee(ctx, in) },
+	}
+	for name, stage := range stages {
+		t.Run(name+"/blocked on a receive", func(t *testing.T) {
+			defer checkLeaks(t)()
+			ctx, cancel := context.WithCancel(context.Background())
+			stage(ctx, make(chan int)) // an input that never sends and is never closed
+			cancel()
+		})
+		t.Run(name+"/blocked on a send", func(t *testing.T) {
+			defer checkLeaks(t)()
+			ctx, cancel := context.WithCancel(context.Background())
+			in := make(chan int, 100)
+			for i := range 100 {
+				in <- i
+			}
+			stage(ctx, in) // the outputs are never read
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+		})
+	}
+}
+
+// without cancel() the stages stay blocked: this is the leak checkLeaks() reports
+func TestConsumerStopsWithoutCancel(t *testing.T) {
+	defer checkLeaks(t)() // checked after cancel(): the blocked goroutines must return
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := mapValues(ctx, generate(ctx, func(i int) (int, bool) { return i, true }), func(n int) int { return n })
+	<-out
+	<-out
+	time.Sleep(10 * time.Millisecond)
+	if blocked := runtime.NumGoroutine() - before; blocked != 2 {
+		t.Errorf("%d goroutines blocked, want 2 (generate and mapValues)", blocked)
+	}
+	cancel()
+}
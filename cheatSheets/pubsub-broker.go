@@ -0,0 +1,459 @@
+/////////////////////////////////
+// A Publish/Subscribe Broker with Topics and Slow-Consumer Policies
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+// Execute: go run pubsub-broker.go
+
+// Publishers send messages to a topic like "orders.created", without knowing who receives them.
+// Subscribers receive the messages of the topics matching a pattern:
+// *  matches exactly one word:  orders.*  matches orders.created, not orders.eu.created
+// #  matches zero or more words: orders.# matches orders, orders.created and orders.eu.created
+//
+// Every subscriber has its own buffered channel. A send to a full buffered channel blocks (see channels.go),
+// so a single slow subscriber would block the publisher and ALL the other subscribers.
+// The policy of a subscriber says what happens when its buffer is full:
+// - block:       the publisher waits (until its context is done)
+// - drop oldest: the oldest message of the buffer is discarded to make room (the subscriber sees the latest data)
+// - drop newest: the new message is discarded (the subscriber sees the first messages)
+// - disconnect:  the subscriber is removed and its channel closed
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/////////////////////////////////
+// Topics and Patterns
+/////////////////////////////////
+
+// declaring a function that reports if a topic matches a pattern
+func matchTopic(pattern, topic string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(topic, "."))
+}
+
+func matchWords(pattern, topic []string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case "#":
+			// # can eat 0, 1, 2, ... words: trying all the possibilities
+			for i := 0; i <= len(topic); i++ {
+				if matchWords(pattern[1:], topic[i:]) {
+					return true
+				}
+			}
+			return false
+		case "*":
+			if len(topic) == 0 {
+				return false
+			}
+		default:
+			if len(topic) == 0 || pattern[0] != topic[0] {
+				return false
+			}
+		}
+		pattern, topic = pattern[1:], topic[1:]
+	}
+	return len(topic) == 0
+}
+
+/////////////////////////////////
+// Subscriptions
+/////////////////////////////////
+
+type policy int
+
+const (
+	block policy = iota
+	dropOldest
+	dropNewest
+	disconnect
+)
+
+func (p policy) String() string {
+	return [...]string{"block", "drop-oldest", "drop-newest", "disconnect"}[p]
+}
+
+// declaring a struct type for a message
+type message struct {
+	Topic   string
+	Payload any
+}
+
+var (
+	errClosed       = errors.New("broker is closed")
+	errDisconnected = errors.New("disconnected: the subscriber was too slow")
+	errBufferSize   = errors.New("the buffer must hold at least 1 message")
+)
+
+// declaring a struct type for a subscriber
+// The publishers send to ch holding the read lock of mu, the write lock is needed to close it:
+// a message is never sent to a closed channel (that would panic).
+type subscription struct {
+	id      int
+	pattern string
+	policy  policy
+	ch      chan message
+	done    chan struct{} // closed first when the subscription ends: unblocks the publishers waiting on ch
+	broker  *broker
+	once    sync.Once
+
+	mu     sync.RWMutex
+	closed bool // ch is closed
+	err    error
+
+	delivered atomic.Int64
+	dropped   atomic.Int64
+}
+
+// method that returns the channel of the messages; it's closed by Unsubscribe(), a disconnection or broker.Close()
+func (s *subscription) C() <-chan message {
+	return s.ch
+}
+
+// method that returns why the channel was closed (nil after Unsubscribe() or broker.Close())
+func (s *subscription) Err() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.err
+}
+
+// method that reports if the subscription ended
+func (s *subscription) ended() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// method that removes the subscription; the messages already in the buffer can still be received
+func (s *subscription) Unsubscribe() {
+	s.broker.remove(s, nil)
+}
+
+/////////////////////////////////
+// The Broker
+/////////////////////////////////
+
+// declaring a struct type for the broker
+// mu protects the map of the subscribers. Publish() holds the read lock only to find the matching subscribers,
+// and delivers after RUnlock(): a publisher blocked on a slow subscriber must not block Subscribe(),
+// Unsubscribe() or the other publishers (a waiting Lock() blocks the new RLock() calls too).
+type broker struct {
+	mu     sync.RWMutex
+	subs   map[int]*subscription
+	nextID int
+	closed bool
+
+	closing   chan struct{} // closed first by Close(): unblocks the publishers waiting on a subscriber
+	closeOnce sync.Once
+
+	published    atomic.Int64
+	delivered    atomic.Int64
+	dropped      atomic.Int64
+	disconnected atomic.Int64
+}
+
+func newBroker() *broker {
+	return &broker{subs: make(map[int]*subscription), closing: make(chan struct{})}
+}
+
+// method that adds a subscriber with a buffer of size messages
+func (b *broker) Subscribe(pattern string, size int, p policy) (*subscription, error) {
+	// an unbuffered channel has no oldest message to drop: every policy needs a buffer
+	if size < 1 {
+		return nil, fmt.Errorf("size %d: %w", size, errBufferSize)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, errClosed
+	}
+	b.nextID++
+	s := &subscription{id: b.nextID, pattern: pattern, policy: p, ch: make(chan message, size), done: make(chan struct{}), broker: b}
+	b.subs[s.id] = s
+	return s, nil
+}
+
+// method that ends a subscription, err is the reason returned by Err()
+func (b *broker) remove(s *subscription, err error) {
+	s.once.Do(func() {
+		close(s.done) // first: a publisher blocked on s.ch holds the read lock of s.mu, it must give up before we can lock
+		b.mu.Lock()
+		delete(b.subs, s.id)
+		b.mu.Unlock()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.err = err
+		s.closed = true
+		close(s.ch)
+	})
+}
+
+// method that sends a message to all the matching subscribers.
+// It returns an error if a blocking subscriber couldn't receive it before the context was done.
+func (b *broker) Publish(ctx context.Context, topic string, payload any) error {
+	msg := message{topic, payload}
+	var slow []*subscription
+	var err error
+
+	// a snapshot of the matching subscribers: the lock is not held while delivering
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return errClosed
+	}
+	b.published.Add(1)
+	var matching []*subscription
+	for _, s := range b.subs {
+		if matchTopic(s.pattern, topic) {
+			matching = append(matching, s)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, s := range matching {
+		switch ok := b.deliver(ctx, s, msg); {
+		case ok:
+			s.delivered.Add(1)
+			b.delivered.Add(1)
+		case s.ended():
+			// unsubscribed after the snapshot: the message is not for it anymore
+		case s.policy == disconnect:
+			slow = append(slow, s)
+		default:
+			s.dropped.Add(1)
+			b.dropped.Add(1)
+			if s.policy == block && err == nil && ctx.Err() != nil { // not after a Close()
+				err = fmt.Errorf("subscriber %d (%s): %w", s.id, s.pattern, ctx.Err())
+			}
+		}
+	}
+
+	for _, s := range slow {
+		b.disconnected.Add(1)
+		b.remove(s, errDisconnected)
+	}
+	return err
+}
+
+// method that tries to put a message in the buffer of a subscriber, following its policy
+func (b *broker) deliver(ctx context.Context, s *subscription, msg message) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return false
+	}
+	select {
+	case s.ch <- msg:
+		return true
+	default: // the buffer is full
+	}
+
+	switch s.policy {
+	case block:
+		select {
+		case s.ch <- msg:
+			return true
+		case <-ctx.Done():
+		case <-s.done:
+		case <-b.closing:
+		}
+		return false
+	case dropOldest:
+		for {
+			// the other publishers can keep the buffer full: the loop must stop with them
+			select {
+			case <-s.ch: // discarding the oldest message
+				s.dropped.Add(1)
+				b.dropped.Add(1)
+			case <-ctx.Done():
+				return false
+			case <-s.done:
+				return false
+			case <-b.closing:
+				return false
+			default:
+			}
+			select {
+			case s.ch <- msg:
+				return true
+			default: // another publisher filled the free slot first: trying again
+			}
+		}
+	}
+	return false // drop newest and disconnect
+}
+
+// method that stops the broker: the subscriber channels are closed, the messages already buffered can still be received
+func (b *broker) Close() {
+	b.closeOnce.Do(func() { close(b.closing) })
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	subs := make([]*subscription, 0, len(b.subs))
+	for _, s := range b.subs {
+		subs = append(subs, s)
+	}
+	b.mu.Unlock()
+	for _, s := range subs {
+		s.Unsubscribe()
+	}
+}
+
+// declaring a struct type for the metrics of the broker
+type metrics struct {
+	Published, Delivered, Dropped, Disconnected int64
+	Subscribers                                 int
+	Queued                                      int // messages waiting in the buffers
+}
+
+func (b *broker) Metrics() metrics {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	m := metrics{
+		Published:    b.published.Load(),
+		Delivered:    b.delivered.Load(),
+		Dropped:      b.dropped.Load(),
+		Disconnected: b.disconnected.Load(),
+		Subscribers:  len(b.subs),
+	}
+	for _, s := range b.subs {
+		m.Queued += len(s.ch)
+	}
+	return m
+}
+
+// a helper function that receives all the buffered messages without blocking
+func drain(s *subscription) []any {
+	var payloads []any
+	for {
+		select {
+		case msg, ok := <-s.C():
+			if !ok {
+				return payloads
+			}
+			payloads = append(payloads, msg.Payload)
+		default:
+			return payloads
+		}
+	}
+}
+
+func main() {
+	ctx := context.Background()
+
+	// WILDCARDS
+	b := newBroker()
+	patterns := []string{"orders.created", "orders.*", "orders.#", "*.created", "#"}
+	subs := make([]*subscription, len(patterns))
+	for i, p := range patterns {
+		subs[i], _ = b.Subscribe(p, 10, block)
+	}
+	for _, topic := range []string{"orders", "orders.created", "orders.eu.created", "payments.created"} {
+		b.Publish(ctx, topic, topic)
+	}
+	for _, s := range subs {
+		fmt.Printf("%-15s %v\n", s.pattern, drain(s))
+	}
+	// => orders.created  [orders.created]
+	// => orders.*        [orders.created]
+	// => orders.#        [orders orders.created orders.eu.created]
+	// => *.created       [orders.created payments.created]
+	// => #               [orders orders.created orders.eu.created payments.created]
+	b.Close()
+
+	// SLOW CONSUMERS: buffers of 2 messages, 5 messages published, nobody reading
+	b = newBroker()
+	slow := map[policy]*subscription{}
+	for _, p := range []policy{dropNewest, dropOldest, disconnect, block} {
+		slow[p], _ = b.Subscribe("prices", 2, p)
+	}
+	for i := 1; i <= 5; i++ {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		if err := b.Publish(ctx, "prices", i); err != nil {
+			fmt.Printf("publish %d: %v\n", i, err)
+		}
+		cancel()
+	}
+	// => publish 3: subscriber 4 (prices): context deadline exceeded
+	// => publish 4: subscriber 4 (prices): context deadline exceeded
+	// => publish 5: subscriber 4 (prices): context deadline exceeded
+	for _, p := range []policy{dropNewest, dropOldest, disconnect, block} {
+		s := slow[p]
+		fmt.Printf("%-12s received %v delivered %d dropped %d err: %v\n", p, drain(s), s.delivered.Load(), s.dropped.Load(), s.Err())
+	}
+	// => drop-newest  received [1 2] delivered 2 dropped 3 err: <nil>
+	// => drop-oldest  received [4 5] delivered 5 dropped 3 err: <nil>
+	// => disconnect   received [1 2] delivered 2 dropped 0 err: disconnected: the subscriber was too slow
+	// => block        received [1 2] delivered 2 dropped 3 err: <nil>
+	fmt.Printf("%+v\n", b.Metrics())
+	// => {Published:5 Delivered:11 Dropped:9 Disconnected:1 Subscribers:3 Queued:0}
+	b.Close()
+
+	// A BLOCKING SUBSCRIBER THAT READS: the publisher waits for it, no message is lost
+	b = newBroker()
+	s, _ := b.Subscribe("logs.#", 1, block)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		count := 0
+		for range s.C() { // ends when the broker is closed
+			time.Sleep(time.Millisecond)
+			count++
+		}
+		fmt.Println("subscriber received", count, "messages")
+	}()
+	for i := 0; i < 100; i++ {
+		b.Publish(ctx, "logs.app", i)
+	}
+
+	// UNSUBSCRIBE: a subscriber that stops early
+	other, _ := b.Subscribe("logs.#", 10, dropNewest)
+	b.Publish(ctx, "logs.app", "a")
+	other.Unsubscribe()
+	b.Publish(ctx, "logs.app", "b")
+	fmt.Println("unsubscribed received", drain(other)) // => unsubscribed received [a]
+
+	// GRACEFUL SHUTDOWN: the channels are closed after the buffered messages, so range loops end
+	b.Close()
+	wg.Wait()
+	// => subscriber received 102 messages
+	fmt.Println(b.Publish(ctx, "logs.app", "late")) // => broker is closed
+	fmt.Printf("%+v\n", b.Metrics())
+	// => {Published:102 Delivered:103 Dropped:0 Disconnected:0 Subscribers:0 Queued:0}
+
+	// UNSUBSCRIBE WHILE A PUBLISHER IS BLOCKED ON ANOTHER SUBSCRIBER: neither waits for the other
+	b = newBroker()
+	b.Subscribe("jobs", 1, block) // nobody reads it
+	quick, _ := b.Subscribe("jobs", 10, dropNewest)
+	b.Publish(ctx, "jobs", 1) // the buffer of the blocking subscriber is full
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	go b.Publish(timeoutCtx, "jobs", 2) // blocked for a second
+	time.Sleep(10 * time.Millisecond)
+	start := time.Now()
+	quick.Unsubscribe()
+	b.Subscribe("jobs", 10, dropNewest)
+	fmt.Println("waited for the publisher:", time.Since(start) > 100*time.Millisecond) // => waited for the publisher: false
+
+	// A SUBSCRIBER NEEDS A BUFFER
+	_, err := b.Subscribe("jobs", 0, dropOldest)
+	fmt.Println(err) // => size 0: the buffer must hold at least 1 message
+	b.Close()
+}
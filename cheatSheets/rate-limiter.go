@@ -0,0 +1,404 @@
+/////////////////////////////////
+// Rate Limiters: Token Bucket, Leaky Bucket and Sliding Window Log
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+// Execute: go run rate-limiter.go
+// The tests use a fake clock that moves only when they say so: they run instantly and always give the same results.
+// Execute: go test -v rate-limiter.go rate-limiter_test.go
+
+// mutex.go and data-race.go pace the goroutines with time.Sleep(time.Second / 10).
+// A sleep doesn't count the time spent working and can't be shared by many goroutines.
+// A rate limiter allows N events per second, whatever the number of goroutines asking:
+// - token bucket:   a bucket of `burst` tokens refilled at `rate` tokens per second; an event takes a token.
+//                   Allows bursts after a quiet period, the average rate is limited.
+// - leaky bucket:   events leave a queue at a constant rate, one every 1/rate seconds. No bursts at all.
+// - sliding window: at most N events in ANY window of the last W seconds, using a log of the event times.
+//                   Exact, but uses memory for N timestamps.
+//
+// Every limiter has three APIs:
+// - Allow()   reports if an event can happen NOW; if not, the event is dropped (an HTTP 429 reply)
+// - Reserve() books the next slot and says how long to wait for it
+// - Wait(ctx) blocks until the event can happen, or the context is done
+//
+// The limiters read the time from a clock interface: the real one, or the fake one of rate-limiter_test.go.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+/////////////////////////////////
+// Clocks
+/////////////////////////////////
+
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// the real clock of the machine
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+/////////////////////////////////
+// Reservations and Wait
+/////////////////////////////////
+
+// declaring a struct type for a booked slot
+type reservation struct {
+	ok     bool          // false if the slot can never be booked (the queue of the leaky bucket is full)
+	delay  time.Duration // how long to wait before the event
+	cancel func()        // gives the slot back when the event won't happen
+}
+
+// declaring an interface implemented by all the limiters
+type limiter interface {
+	Allow() bool
+	Reserve() reservation
+	Wait(ctx context.Context) error
+}
+
+var (
+	errLimitExceeded = errors.New("rate limit exceeded")
+	errWouldExceed   = errors.New("the wait would exceed the context deadline")
+	errInvalidLimit  = errors.New("invalid limiter setting")
+)
+
+// a helper function that converts seconds to a time.Duration, clamped to the longest one.
+// A float64 too big for an int64 converts to a huge negative Duration: a wait that would end at once.
+func seconds(s float64) time.Duration {
+	switch {
+	case s >= float64(math.MaxInt64)/float64(time.Second):
+		return math.MaxInt64
+	case s > 0:
+		return time.Duration(s * float64(time.Second))
+	}
+	return 0
+}
+
+// declaring a function that implements Wait() on top of Reserve()
+func wait(ctx context.Context, clk clock, r reservation) error {
+	if !r.ok {
+		return errLimitExceeded
+	}
+	if r.delay == 0 {
+		return nil
+	}
+	// giving up now is better than waiting and failing at the deadline
+	// (the time left is measured with the clock of the limiter, the deadline of a test is in fake time)
+	if deadline, ok := ctx.Deadline(); ok && deadline.Sub(clk.Now()) < r.delay {
+		r.cancel()
+		return errWouldExceed
+	}
+	select {
+	case <-clk.After(r.delay):
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		return ctx.Err()
+	}
+}
+
+/////////////////////////////////
+// Token Bucket
+/////////////////////////////////
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	clock  clock
+	rate   float64 // tokens added per second
+	burst  float64 // the size of the bucket
+	tokens float64 // negative when slots in the future are reserved
+	last   time.Time
+}
+
+// a rate of 0 would never refill the bucket, a burst of 0 would never allow an event
+func newTokenBucket(clk clock, rate float64, burst int) (*tokenBucket, error) {
+	if !(rate > 0) || math.IsInf(rate, 1) {
+		return nil, fmt.Errorf("rate %v: %w", rate, errInvalidLimit)
+	}
+	if burst < 1 {
+		return nil, fmt.Errorf("burst %d: %w", burst, errInvalidLimit)
+	}
+	return &tokenBucket{clock: clk, rate: rate, burst: float64(burst), tokens: float64(burst), last: clk.Now()}, nil
+}
+
+// method that adds the tokens refilled since the last call; the caller holds the mutex
+func (tb *tokenBucket) refill() {
+	now := tb.clock.Now()
+	tb.tokens = min(tb.burst, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+	tb.last = now
+}
+
+func (tb *tokenBucket) Allow() bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.refill()
+	if tb.tokens >= 1 {
+		tb.tokens--
+		return true
+	}
+	return false
+}
+
+func (tb *tokenBucket) Reserve() reservation {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.refill()
+	tb.tokens-- // may go below 0: the token is taken from the future
+	var delay time.Duration
+	if tb.tokens < 0 {
+		delay = seconds(-tb.tokens / tb.rate)
+	}
+	return reservation{ok: true, delay: delay, cancel: func() {
+		tb.mu.Lock()
+		defer tb.mu.Unlock()
+		tb.refill()
+		tb.tokens = min(tb.burst, tb.tokens+1)
+	}}
+}
+
+func (tb *tokenBucket) Wait(ctx context.Context) error {
+	return wait(ctx, tb.clock, tb.Reserve())
+}
+
+/////////////////////////////////
+// Leaky Bucket
+/////////////////////////////////
+
+type leakyBucket struct {
+	mu       sync.Mutex
+	clock    clock
+	interval time.Duration // the time between two events
+	maxDelay time.Duration // the wait of the last place in the queue: capacity intervals
+	next     time.Time     // the time of the next free slot
+}
+
+// capacity is the number of events that can wait in the queue
+func newLeakyBucket(clk clock, rate float64, capacity int) (*leakyBucket, error) {
+	interval := seconds(1 / rate)
+	if !(rate > 0) || interval <= 0 { // a rate above 1e9 per second gives an interval of 0
+		return nil, fmt.Errorf("rate %v: %w", rate, errInvalidLimit)
+	}
+	if capacity < 0 {
+		return nil, fmt.Errorf("capacity %d: %w", capacity, errInvalidLimit)
+	}
+	// capacity*interval can overflow an int64
+	maxDelay := time.Duration(math.MaxInt64)
+	if int64(capacity) < math.MaxInt64/int64(interval) {
+		maxDelay = time.Duration(capacity) * interval
+	}
+	return &leakyBucket{clock: clk, interval: interval, maxDelay: maxDelay}, nil
+}
+
+func (lb *leakyBucket) Allow() bool {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	now := lb.clock.Now()
+	if lb.next.After(now) {
+		return false // the previous event was less than an interval ago
+	}
+	lb.next = now.Add(lb.interval)
+	return true
+}
+
+func (lb *leakyBucket) Reserve() reservation {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	now := lb.clock.Now()
+	at := now
+	if lb.next.After(now) {
+		at = lb.next
+	}
+	delay := at.Sub(now)
+	if delay > lb.maxDelay {
+		return reservation{} // the queue is full: the bucket overflows
+	}
+	lb.next = at.Add(lb.interval)
+	return reservation{ok: true, delay: delay, cancel: func() {
+		lb.mu.Lock()
+		defer lb.mu.Unlock()
+		if lb.next.Equal(at.Add(lb.interval)) { // only the last slot can be given back
+			lb.next = at
+		}
+	}}
+}
+
+func (lb *leakyBucket) Wait(ctx context.Context) error {
+	return wait(ctx, lb.clock, lb.Reserve())
+}
+
+/////////////////////////////////
+// Sliding Window Log
+/////////////////////////////////
+
+type slidingWindow struct {
+	mu     sync.Mutex
+	clock  clock
+	limit  int
+	window time.Duration
+	log    []time.Time // the times of the events in the window (and of the reserved ones), sorted
+}
+
+func newSlidingWindow(clk clock, limit int, window time.Duration) (*slidingWindow, error) {
+	if limit < 1 {
+		return nil, fmt.Errorf("limit %d: %w", limit, errInvalidLimit)
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("window %v: %w", window, errInvalidLimit)
+	}
+	return &slidingWindow{clock: clk, limit: limit, window: window}, nil
+}
+
+// method that removes the events older than the window; the caller holds the mutex
+func (sw *slidingWindow) expire(now time.Time) {
+	i := sort.Search(len(sw.log), func(i int) bool { return sw.log[i].After(now.Add(-sw.window)) })
+	sw.log = sw.log[i:]
+}
+
+func (sw *slidingWindow) Allow() bool {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	now := sw.clock.Now()
+	sw.expire(now)
+	if len(sw.log) >= sw.limit {
+		return false
+	}
+	sw.log = append(sw.log, now)
+	return true
+}
+
+func (sw *slidingWindow) Reserve() reservation {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	now := sw.clock.Now()
+	sw.expire(now)
+	at := now
+	if len(sw.log) >= sw.limit {
+		// the slot frees when the event `limit` places before the end leaves the window
+		at = sw.log[len(sw.log)-sw.limit].Add(sw.window)
+	}
+	sw.log = append(sw.log, at)
+	return reservation{ok: true, delay: at.Sub(now), cancel: func() {
+		sw.mu.Lock()
+		defer sw.mu.Unlock()
+		for i := len(sw.log) - 1; i >= 0; i-- {
+			if sw.log[i].Equal(at) {
+				sw.log = append(sw.log[:i], sw.log[i+1:]...)
+				break
+			}
+		}
+	}}
+}
+
+func (sw *slidingWindow) Wait(ctx context.Context) error {
+	return wait(ctx, sw.clock, sw.Reserve())
+}
+
+/////////////////////////////////
+// Keyed Limiters
+/////////////////////////////////
+
+// declaring a generic struct type with a limiter per key (per user, per IP address, ...).
+// The limiters not used for `idle` are removed, else the map would grow forever.
+// idle must be long enough for a limiter to be back to its initial state: burst/rate seconds for a token bucket.
+type keyedLimiter[K comparable] struct {
+	mu        sync.Mutex
+	clock     clock
+	newFunc   func() limiter
+	idle      time.Duration
+	entries   map[K]*keyedEntry
+	lastSweep time.Time
+}
+
+type keyedEntry struct {
+	limiter  limiter
+	lastUsed time.Time
+}
+
+func newKeyedLimiter[K comparable](clk clock, idle time.Duration, newFunc func() limiter) *keyedLimiter[K] {
+	return &keyedLimiter[K]{clock: clk, newFunc: newFunc, idle: idle, entries: make(map[K]*keyedEntry), lastSweep: clk.Now()}
+}
+
+// method that returns the limiter of a key, creating it if needed
+func (k *keyedLimiter[K]) Get(key K) limiter {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	now := k.clock.Now()
+	// sweeping at most once per idle period keeps Get() O(1) on average
+	if now.Sub(k.lastSweep) >= k.idle {
+		for key, e := range k.entries {
+			if now.Sub(e.lastUsed) >= k.idle {
+				delete(k.entries, key)
+			}
+		}
+		k.lastSweep = now
+	}
+	e, ok := k.entries[key]
+	if !ok {
+		e = &keyedEntry{limiter: k.newFunc()}
+		k.entries[key] = e
+	}
+	e.lastUsed = now
+	return e.limiter
+}
+
+func (k *keyedLimiter[K]) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.entries)
+}
+
+func main() {
+	// TOKEN BUCKET: 2 events per second, bursts of 3
+	// (rate-limiter_test.go checks every limiter with a fake clock)
+	tb, err := newTokenBucket(realClock{}, 2, 3)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var results []bool
+	for i := 0; i < 5; i++ {
+		results = append(results, tb.Allow())
+	}
+	fmt.Println(results) // => [true true true false false]
+
+	// WAIT AND CONTEXTS: the next token comes in 500ms, after the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	fmt.Println(tb.Wait(ctx)) // => the wait would exceed the context deadline
+	cancel()
+
+	// THE REAL CLOCK: replacing time.Sleep(time.Second / 10) in a loop
+	rl, err := newTokenBucket(realClock{}, 10, 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ { // 3 goroutines share the same limit
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 3; j++ {
+				rl.Wait(context.Background())
+			}
+		}()
+	}
+	wg.Wait()
+	fmt.Println("9 events in", time.Since(start).Round(10*time.Millisecond)) // => 9 events in 800ms
+
+	// A RATE OF 0 IS AN ERROR, not a limiter that lets everything through
+	_, err = newLeakyBucket(realClock{}, 0, 10)
+	fmt.Println(err) // => rate 0: invalid limiter setting
+}
@@ -0,0 +1,268 @@
+/////////////////////////////////
+// Tests: Rate Limiters with a Fake Clock
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Execute: go test -v rate-limiter.go rate-limiter_test.go
+
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// declaring a struct type for a clock that moves only when Advance() is called
+type fakeClock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	c := &fakeClock{now: time.Date(2019, 10, 21, 12, 0, 0, 0, time.UTC)}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, fakeTimer{c.now.Add(d), ch})
+	c.cond.Broadcast()
+	return ch
+}
+
+// method that moves the clock forward and fires the timers that expired
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			t.ch <- c.now
+		}
+	}
+	c.timers = pending
+}
+
+// method that blocks until n goroutines wait on After(): a test knows they're blocked before it advances the clock
+func (c *fakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+// a helper function that calls Allow() n times
+func allow(l limiter, n int) []bool {
+	var results []bool
+	for i := 0; i < n; i++ {
+		results = append(results, l.Allow())
+	}
+	return results
+}
+
+// a helper function that compares the results of Allow()
+func checkAllow(t *testing.T, l limiter, want ...bool) {
+	t.Helper()
+	if got := allow(l, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Allow() = %v, want %v", got, want)
+	}
+}
+
+// 2 events per second, bursts of 3
+func TestTokenBucket(t *testing.T) {
+	clk := newFakeClock()
+	tb, err := newTokenBucket(clk, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAllow(t, tb, true, true, true, false, false)
+	clk.Advance(500 * time.Millisecond)
+	checkAllow(t, tb, true, false) // one token refilled
+	if d1, d2 := tb.Reserve().delay, tb.Reserve().delay; d1 != 500*time.Millisecond || d2 != time.Second {
+		t.Errorf("Reserve() delays = %v, %v, want 500ms, 1s", d1, d2)
+	}
+	clk.Advance(10 * time.Second)              // a quiet period refills the bucket...
+	checkAllow(t, tb, true, true, true, false) // ...but not more than the burst
+}
+
+// 2 events per second, a queue of 3, no bursts
+func TestLeakyBucket(t *testing.T) {
+	clk := newFakeClock()
+	lb, err := newLeakyBucket(clk, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAllow(t, lb, true, false)
+	want := []reservation{
+		{ok: true, delay: 500 * time.Millisecond},
+		{ok: true, delay: time.Second},
+		{ok: true, delay: 1500 * time.Millisecond},
+		{ok: false}, // the queue is full
+	}
+	for i, w := range want {
+		if r := lb.Reserve(); r.ok != w.ok || r.delay != w.delay {
+			t.Errorf("Reserve() %d = %v %v, want %v %v", i, r.ok, r.delay, w.ok, w.delay)
+		}
+	}
+}
+
+// 3 events in any second
+func TestSlidingWindow(t *testing.T) {
+	clk := newFakeClock()
+	sw, err := newSlidingWindow(clk, 3, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAllow(t, sw, true, true)
+	clk.Advance(600 * time.Millisecond)
+	checkAllow(t, sw, true, false)
+	clk.Advance(400 * time.Millisecond)
+	// the 2 events of t=0 left the window, the one of t=600ms didn't
+	// (a fixed window, a counter reset every second, would allow 6 events between t=0.9s and t=1.1s)
+	checkAllow(t, sw, true, true, false)
+}
+
+func TestWait(t *testing.T) {
+	clk := newFakeClock()
+	tb, err := newTokenBucket(clk, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb.Allow() // the bucket is empty
+
+	// no real sleep: the clock is advanced when the goroutine is waiting on it
+	done := make(chan error)
+	go func() { done <- tb.Wait(context.Background()) }()
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Errorf("Wait() = %v", err)
+	}
+
+	// a deadline in fake time: the token needs 1s, only 100ms are left
+	ctx, cancel := context.WithDeadline(context.Background(), clk.Now().Add(100*time.Millisecond))
+	if err := tb.Wait(ctx); !errors.Is(err, errWouldExceed) {
+		t.Errorf("Wait() before the deadline = %v, want %v", err, errWouldExceed)
+	}
+	cancel()
+
+	// a cancelled wait gives the reserved token back
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() { done <- tb.Wait(ctx) }()
+	clk.BlockUntil(1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled Wait() = %v, want %v", err, context.Canceled)
+	}
+	clk.Advance(time.Second)
+	checkAllow(t, tb, true, false)
+}
+
+// one token bucket per IP address, removed after 1 minute without requests
+func TestKeyedLimiter(t *testing.T) {
+	clk := newFakeClock()
+	perIP := newKeyedLimiter[string](clk, time.Minute, func() limiter {
+		tb, err := newTokenBucket(clk, 1, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tb
+	})
+	perIP.Get("10.0.0.1").Allow()
+	perIP.Get("10.0.0.2").Allow()
+	clk.Advance(30 * time.Second)
+	perIP.Get("10.0.0.1").Allow()
+	clk.Advance(40 * time.Second)
+	perIP.Get("10.0.0.3").Allow()
+	if n := perIP.Len(); n != 2 { // 10.0.0.2 was idle for 70s
+		t.Errorf("Len() = %d, want 2", n)
+	}
+}
+
+func TestInvalidSettings(t *testing.T) {
+	clk := newFakeClock()
+	tokenBuckets := []struct {
+		rate  float64
+		burst int
+	}{{0, 1}, {-1, 1}, {math.Inf(1), 1}, {math.NaN(), 1}, {1, 0}}
+	for _, tt := range tokenBuckets {
+		if _, err := newTokenBucket(clk, tt.rate, tt.burst); !errors.Is(err, errInvalidLimit) {
+			t.Errorf("newTokenBucket(%v, %d) = %v, want %v", tt.rate, tt.burst, err, errInvalidLimit)
+		}
+	}
+	leakyBuckets := []struct {
+		rate     float64
+		capacity int
+	}{{0, 1}, {-1, 1}, {math.NaN(), 1}, {2e9, 1}, {1, -1}} // 2e9 per second: an interval below 1ns
+	for _, tt := range leakyBuckets {
+		if _, err := newLeakyBucket(clk, tt.rate, tt.capacity); !errors.Is(err, errInvalidLimit) {
+			t.Errorf("newLeakyBucket(%v, %d) = %v, want %v", tt.rate, tt.capacity, err, errInvalidLimit)
+		}
+	}
+	slidingWindows := []struct {
+		limit  int
+		window time.Duration
+	}{{0, time.Second}, {1, 0}, {1, -time.Second}}
+	for _, tt := range slidingWindows {
+		if _, err := newSlidingWindow(clk, tt.limit, tt.window); !errors.Is(err, errInvalidLimit) {
+			t.Errorf("newSlidingWindow(%d, %v) = %v, want %v", tt.limit, tt.window, err, errInvalidLimit)
+		}
+	}
+}
+
+// a delay longer than an int64 of nanoseconds is clamped, it doesn't wrap around to a negative one
+func TestHugeDelays(t *testing.T) {
+	clk := newFakeClock()
+	tb, err := newTokenBucket(clk, 1e-300, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb.Allow() // the next token comes in 1e300 seconds
+	if d := tb.Reserve().delay; d != math.MaxInt64 {
+		t.Errorf("Reserve().delay = %v, want %v", d, time.Duration(math.MaxInt64))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	if err := tb.Wait(ctx); !errors.Is(err, errWouldExceed) {
+		t.Errorf("Wait() = %v, want %v", err, errWouldExceed)
+	}
+
+	// 1 event every 1e6 seconds and a queue of 1e9 events: capacity*interval overflows
+	lb, err := newLeakyBucket(clk, 1e-6, 1e9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb.Allow()
+	if r := lb.Reserve(); !r.ok || r.delay != 1e6*time.Second {
+		t.Errorf("Reserve() = %v %v, want true %v", r.ok, r.delay, 1e6*time.Second)
+	}
+}
@@ -0,0 +1,497 @@
+/////////////////////////////////
+// A Fixed-Size Binary Record File with Random Access (encoding/binary, ReadAt, WriteAt)
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+// Execute: go run record-store.go
+// (it creates books.db in a temporary directory and shows every operation)
+
+// Dumping or repairing an existing file:
+// go run record-store.go dump books.db
+// go run record-store.go repair books.db
+
+// Every record has the same size, so record i starts at headerSize + i*recordSize
+// and can be read or written directly with ReadAt()/WriteAt(), without reading the records before it.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// the book struct type of structs.go
+type book struct {
+	title  string
+	author string
+	year   int
+}
+
+/////////////////////////////////
+// The File Format
+/////////////////////////////////
+
+// declaring the header struct; encoding/binary needs fixed-size fields (no strings, slices or int)
+type fileHeader struct {
+	Magic      [4]byte // "BOOK", identifies the file type
+	Version    uint16  // the schema version of the records
+	RecordSize uint16
+	CRC        uint32 // checksum of the fields above
+}
+
+// declaring the record struct as it's stored on disk
+type bookRecord struct {
+	Deleted uint8 // 1 is a tombstone: the record was deleted but its space was not reclaimed yet
+	Title   [64]byte
+	Author  [48]byte
+	Year    int32
+	CRC     uint32 // checksum of the fields above
+}
+
+const schemaVersion = 1
+
+var (
+	magic      = [4]byte{'B', 'O', 'O', 'K'}
+	headerSize = int64(binary.Size(fileHeader{})) // => 12
+	recordSize = int64(binary.Size(bookRecord{})) // => 121
+)
+
+var (
+	errNotFound = errors.New("record not found")
+	errDeleted  = errors.New("record deleted")
+	errChecksum = errors.New("checksum mismatch")
+	errYear     = errors.New("year out of range")
+)
+
+// a helper function that converts a string to a fixed-size array, cutting it if it's too long
+// the cut is at the start of a rune, so the string never ends with the first bytes of a "é" or a "传".
+func toFixed(s string, dst []byte) {
+	n := len(s)
+	if n > len(dst) {
+		n = len(dst)
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+	}
+	copy(dst, s[:n])
+	for i := n; i < len(dst); i++ {
+		dst[i] = 0
+	}
+}
+
+// a helper function that converts a zero-padded array back to a string
+func fromFixed(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// declaring a function that encodes a record and computes its checksum
+// the year is stored in an int32: a year that doesn't fit is an error, not a different year.
+func encodeRecord(b book, deleted bool) ([]byte, error) {
+	if b.year < math.MinInt32 || b.year > math.MaxInt32 {
+		return nil, fmt.Errorf("%d: %w", b.year, errYear)
+	}
+	var rec bookRecord
+	if deleted {
+		rec.Deleted = 1
+	}
+	toFixed(b.title, rec.Title[:])
+	toFixed(b.author, rec.Author[:])
+	rec.Year = int32(b.year)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, rec) // writing to a bytes.Buffer never fails
+	data := buf.Bytes()
+	// the checksum covers everything except the last 4 bytes (the CRC field itself)
+	binary.LittleEndian.PutUint32(data[len(data)-4:], crc32.ChecksumIEEE(data[:len(data)-4]))
+	return data, nil
+}
+
+// declaring a function that decodes and verifies a record
+func decodeRecord(data []byte) (book, bool, error) {
+	var rec bookRecord
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &rec); err != nil {
+		return book{}, false, err
+	}
+	if crc32.ChecksumIEEE(data[:len(data)-4]) != rec.CRC {
+		return book{}, false, errChecksum
+	}
+	b := book{title: fromFixed(rec.Title[:]), author: fromFixed(rec.Author[:]), year: int(rec.Year)}
+	return b, rec.Deleted == 1, nil
+}
+
+/////////////////////////////////
+// The Record Store
+/////////////////////////////////
+
+type recordStore struct {
+	path  string
+	file  *os.File
+	count int64 // the number of records, including the tombstones
+}
+
+// declaring a function that opens a store, creating it if it doesn't exist
+func openStore(path string) (*recordStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &recordStore{path: path, file: file}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if fileInfo.Size() == 0 {
+		err = s.writeHeader()
+	} else {
+		err = s.readHeader()
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	// a partial record at the end (a crash during Append) is ignored; repair removes it
+	s.count = (fileInfo.Size() - headerSize) / recordSize
+	if s.count < 0 {
+		s.count = 0
+	}
+	return s, nil
+}
+
+func (s *recordStore) writeHeader() error {
+	return writeHeader(s.file)
+}
+
+// a helper function that writes the header at the start of a file
+func writeHeader(file *os.File) error {
+	h := fileHeader{Magic: magic, Version: schemaVersion, RecordSize: uint16(recordSize)}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, h)
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint32(data[len(data)-4:], crc32.ChecksumIEEE(data[:len(data)-4]))
+	_, err := file.WriteAt(data, 0)
+	return err
+}
+
+func (s *recordStore) readHeader() error {
+	data := make([]byte, headerSize)
+	if _, err := s.file.ReadAt(data, 0); err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+	var h fileHeader
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, &h)
+	switch {
+	case h.Magic != magic:
+		return errors.New("not a book store")
+	case crc32.ChecksumIEEE(data[:len(data)-4]) != h.CRC:
+		return fmt.Errorf("header: %w", errChecksum)
+	case h.Version != schemaVersion:
+		return fmt.Errorf("unsupported schema version %d", h.Version)
+	case int64(h.RecordSize) != recordSize:
+		return fmt.Errorf("record size %d, expected %d", h.RecordSize, recordSize)
+	}
+	return nil
+}
+
+// a helper method that returns the offset of record i in the file
+func (s *recordStore) offset(i int64) int64 {
+	return headerSize + i*recordSize
+}
+
+// Len method returns the number of records, including the deleted ones
+func (s *recordStore) Len() int64 { return s.count }
+
+// Get method reads record i
+func (s *recordStore) Get(i int64) (book, error) {
+	if i < 0 || i >= s.count {
+		return book{}, fmt.Errorf("%d: %w", i, errNotFound)
+	}
+	data := make([]byte, recordSize)
+	if _, err := s.file.ReadAt(data, s.offset(i)); err != nil {
+		return book{}, err
+	}
+	b, deleted, err := decodeRecord(data)
+	if err != nil {
+		return book{}, fmt.Errorf("record %d: %w", i, err)
+	}
+	if deleted {
+		return book{}, fmt.Errorf("%d: %w", i, errDeleted)
+	}
+	return b, nil
+}
+
+// Put method overwrites record i
+func (s *recordStore) Put(i int64, b book) error {
+	if i < 0 || i >= s.count {
+		return fmt.Errorf("%d: %w", i, errNotFound)
+	}
+	data, err := encodeRecord(b, false)
+	if err != nil {
+		return err
+	}
+	_, err = s.file.WriteAt(data, s.offset(i))
+	return err
+}
+
+// Append method adds a record at the end and returns its index
+func (s *recordStore) Append(b book) (int64, error) {
+	i := s.count
+	data, err := encodeRecord(b, false)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.file.WriteAt(data, s.offset(i)); err != nil {
+		return 0, err
+	}
+	s.count++
+	return i, nil
+}
+
+// Delete method writes a tombstone: the record keeps its place, so the other indexes don't change
+func (s *recordStore) Delete(i int64) error {
+	b, err := s.Get(i)
+	if err != nil {
+		return err
+	}
+	data, err := encodeRecord(b, true)
+	if err != nil {
+		return err
+	}
+	_, err = s.file.WriteAt(data, s.offset(i))
+	return err
+}
+
+// Compact method copies the live records to a new file and renames it over the store.
+// A crash during Compact leaves the old file unchanged, never a mix of the two.
+// ** The indexes of the records after a tombstone change. **
+func (s *recordStore) Compact() (removed int64, err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".compact-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name()) // does nothing after a successful rename
+
+	// os.CreateTemp() creates the file with mode 0600: the new file gets the mode of the old one
+	count, err := s.copyLive(tmp)
+	if fileInfo, serr := s.file.Stat(); err == nil && serr == nil {
+		err = tmp.Chmod(fileInfo.Mode().Perm())
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+
+	// the store goes on with the new file, os.CreateTemp() opened it for reading and writing
+	s.file.Close()
+	s.file = tmp
+	removed = s.count - count
+	s.count = count
+	return removed, nil
+}
+
+// method that writes the header and the live records of the store to dst, it returns their number
+func (s *recordStore) copyLive(dst *os.File) (int64, error) {
+	if err := writeHeader(dst); err != nil {
+		return 0, err
+	}
+	data := make([]byte, recordSize)
+	var n int64
+	for i := int64(0); i < s.count; i++ {
+		if _, err := s.file.ReadAt(data, s.offset(i)); err != nil {
+			return 0, err
+		}
+		if _, deleted, err := decodeRecord(data); err != nil || deleted {
+			continue // corrupt records are dropped too
+		}
+		if _, err := dst.WriteAt(data, s.offset(n)); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Close method closes the file
+func (s *recordStore) Close() error {
+	return s.file.Close()
+}
+
+/////////////////////////////////
+// The dump and repair Commands
+/////////////////////////////////
+
+// declaring a function that prints every record and its status
+func dump(s *recordStore, w io.Writer) {
+	data := make([]byte, recordSize)
+	for i := int64(0); i < s.count; i++ {
+		if _, err := s.file.ReadAt(data, s.offset(i)); err != nil {
+			fmt.Fprintf(w, "%4d  read error: %v\n", i, err)
+			continue
+		}
+		b, deleted, err := decodeRecord(data)
+		switch {
+		case err != nil:
+			fmt.Fprintf(w, "%4d  CORRUPT (%v)\n", i, err)
+		case deleted:
+			fmt.Fprintf(w, "%4d  deleted  %q\n", i, b.title)
+		default:
+			fmt.Fprintf(w, "%4d  %-28q %-20q %d\n", i, b.title, b.author, b.year)
+		}
+	}
+}
+
+// declaring a function that repairs a store: a partial last record is cut and corrupt records
+// become tombstones (their content is lost, but the indexes of the other records don't change)
+func repair(path string) error {
+	s, err := openStore(path)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := s.file.Truncate(s.offset(s.count)); err != nil {
+		return err
+	}
+	data := make([]byte, recordSize)
+	for i := int64(0); i < s.count; i++ {
+		if _, err := s.file.ReadAt(data, s.offset(i)); err != nil {
+			return err
+		}
+		if _, _, err := decodeRecord(data); errors.Is(err, errChecksum) {
+			log.Printf("record %d is corrupt, replacing it with a tombstone\n", i)
+			tombstone, _ := encodeRecord(book{}, true) // an empty book is always valid
+			if _, err := s.file.WriteAt(tombstone, s.offset(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return s.file.Sync()
+}
+
+func main() {
+	if len(os.Args) == 3 {
+		switch os.Args[1] {
+		case "dump":
+			s, err := openStore(os.Args[2])
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer s.Close()
+			dump(s, os.Stdout)
+			return
+		case "repair":
+			if err := repair(os.Args[2]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "records")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "books.db")
+
+	s, err := openStore(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// APPENDING RECORDS
+	books := []book{
+		{"The Divine Comedy", "Dante Aligheri", 1320},
+		{"Animal Farm", "George Orwell", 1945},
+		{"1984", "George Orwell", 1949},
+		{"Just a random book", "", 0},
+	}
+	for _, b := range books {
+		if _, err := s.Append(b); err != nil {
+			log.Fatal(err)
+		}
+	}
+	fmt.Println("Record size:", recordSize, "records:", s.Len()) // => Record size: 121 records: 4
+
+	// RANDOM ACCESS BY INDEX
+	b, err := s.Get(2)
+	fmt.Printf("%+v %v\n", b, err) // => {title:1984 author:George Orwell year:1949} <nil>
+
+	s.Put(3, book{"Brave New World", "Aldous Huxley", 1932})
+
+	// DELETING (tombstones) AND COMPACTING
+	s.Delete(1)
+	_, err = s.Get(1)
+	fmt.Println(err) // => 1: record deleted
+
+	dump(s, os.Stdout)
+	// =>    0  "The Divine Comedy"          "Dante Aligheri"     1320
+	// =>    1  deleted  "Animal Farm"
+	// =>    2  "1984"                       "George Orwell"      1949
+	// =>    3  "Brave New World"            "Aldous Huxley"      1932
+
+	removed, err := s.Compact()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Removed:", removed, "records:", s.Len()) // => Removed: 1 records: 3
+
+	// A YEAR THAT DOESN'T FIT IN THE INT32 FIELD IS REJECTED
+	_, err = s.Append(book{"The Time Machine", "H. G. Wells", 1 << 40})
+	fmt.Println(err) // => 1099511627776: year out of range
+
+	// A LONG TITLE IS CUT AT A RUNE BOUNDARY (the field has 64 bytes, "é" has 2: the 64th byte would be half of one)
+	i, err := s.Append(book{"a" + strings.Repeat("é", 40), "", 0})
+	if err != nil {
+		log.Fatal(err)
+	}
+	b, _ = s.Get(i)
+	fmt.Println(len(b.title), utf8.ValidString(b.title)) // => 63 true
+	s.Delete(i)
+	s.Compact()
+	s.Close()
+
+	// CORRUPTING A RECORD AND REPAIRING THE FILE
+	file, _ := os.OpenFile(path, os.O_RDWR, 0644)
+	file.WriteAt([]byte("XX"), headerSize+recordSize+5) // changing 2 bytes of record 1
+	file.WriteAt([]byte("partial"), headerSize+3*recordSize)
+	file.Close()
+
+	if err := repair(path); err != nil {
+		log.Fatal(err)
+	}
+	// => record 1 is corrupt, replacing it with a tombstone
+
+	s, err = openStore(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Close()
+	dump(s, os.Stdout)
+	// =>    0  "The Divine Comedy"          "Dante Aligheri"     1320
+	// =>    1  deleted  ""
+	// =>    2  "Brave New World"            "Aldous Huxley"      1932
+}
@@ -0,0 +1,374 @@
+/////////////////////////////////
+// A Rotating Log File Writer (io.Writer)
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+// Execute: go run rotating-log-writer.go
+
+// Use Go Race Detector to check that concurrent writes are safe
+// Execute: go run -race rotating-log-writer.go
+
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// declaring a struct type that keeps the rotation rules
+// a zero value for a rule means the rule is disabled.
+type rotateConfig struct {
+	maxSize    int64         // rotate when the file grows beyond maxSize bytes
+	maxAge     time.Duration // rotate when the file is older than maxAge
+	maxLines   int           // rotate after maxLines lines were written
+	timestamp  bool          // name rotated files app.log.20191021-162616 instead of app.log.1, app.log.2, ...
+	compress   bool          // gzip the rotated files (app.log.1.gz)
+	maxBackups int           // keep only the newest maxBackups rotated files
+}
+
+// declaring a struct type that implements the io.Writer interface
+type rotatingWriter struct {
+	path string
+	cfg  rotateConfig
+
+	mu      sync.Mutex // protects all the fields below, so that many goroutines can write at once
+	file    *os.File
+	size    int64
+	lines   int
+	created time.Time
+
+	now     func() time.Time // the clock, it can be replaced to test the age based rotation
+	onError func(error)      // reports the errors that don't stop the logging (compressing and pruning the backups)
+}
+
+// declaring a function that opens (or creates) the log file and returns the writer
+func newRotatingWriter(path string, cfg rotateConfig) (*rotatingWriter, error) {
+	w := &rotatingWriter{path: path, cfg: cfg, now: time.Now, onError: func(err error) {
+		// not using the log package: its output may be this writer
+		fmt.Fprintln(os.Stderr, "rotating writer:", err)
+	}}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// method that opens the log file in append mode
+func (w *rotatingWriter) open() error {
+	// with os.O_APPEND every write goes to the end of the file, even if another process writes to it.
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = fileInfo.Size()
+	w.lines = 0
+	w.created = w.now()
+	if w.size > 0 {
+		// an existing file is as old as its last modification
+		w.created = fileInfo.ModTime()
+	}
+	return nil
+}
+
+// Write method makes *rotatingWriter an io.Writer
+// a write is never split between two files, the file is rotated before writing if needed.
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.shouldRotate(len(p)) {
+		if err := w.rotate(); err != nil {
+			if w.file == nil {
+				return 0, err
+			}
+			// the file was not renamed but it's open again: the logging goes on
+			w.onError(err)
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	w.lines += strings.Count(string(p[:n]), "\n")
+	return n, err
+}
+
+// method that checks the rotation rules
+func (w *rotatingWriter) shouldRotate(n int) bool {
+	if w.size == 0 {
+		return false // never rotate an empty file
+	}
+	if w.cfg.maxSize > 0 && w.size+int64(n) > w.cfg.maxSize {
+		return true
+	}
+	if w.cfg.maxAge > 0 && w.now().Sub(w.created) >= w.cfg.maxAge {
+		return true
+	}
+	if w.cfg.maxLines > 0 && w.lines >= w.cfg.maxLines {
+		return true
+	}
+	return false
+}
+
+// method that closes the current file, renames it and opens a new one.
+// The new file is opened before the backups are compressed and pruned: if they fail, the logging goes on.
+func (w *rotatingWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	var rotated string
+	var err error
+	if w.cfg.timestamp {
+		rotated = w.path + "." + w.now().Format("20060102-150405.000000000")
+	} else {
+		// shifting the numbered backups: app.log.2 -> app.log.3, app.log.1 -> app.log.2
+		err = w.shiftBackups()
+		rotated = w.path + ".1"
+	}
+	if err == nil {
+		err = os.Rename(w.path, rotated)
+	}
+	// (re)opening the active file even if the rename failed, the next write tries again
+	if openErr := w.open(); openErr != nil {
+		return openErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if w.cfg.compress {
+		if err := gzipFile(rotated); err != nil {
+			w.onError(err)
+		}
+	}
+	if err := w.prune(); err != nil {
+		w.onError(err)
+	}
+	return nil
+}
+
+// the names of the rotated files after "app.log": .3 or .3.gz, .20191021-162616.000000000 or .20191021-162616.000000000.gz
+var (
+	numberedSuffix  = regexp.MustCompile(`^\.\d+(\.gz)?$`)
+	timestampSuffix = regexp.MustCompile(`^\.\d{8}-\d{6}\.\d{9}(\.gz)?$`)
+)
+
+// method that returns the rotated files, the newest first.
+// It doesn't use filepath.Glob(w.path + ".*"): a path with [, * or ? would be read as a pattern.
+// Only the names made by rotate() are backups: app.log.old belongs to someone else, it's never renamed or removed.
+func (w *rotatingWriter) backups() ([]string, error) {
+	dir, base := filepath.Split(w.path)
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, err
+	}
+	suffix := numberedSuffix
+	if w.cfg.timestamp {
+		suffix = timestampSuffix
+	}
+	var matches []string
+	for _, e := range entries {
+		rest, ok := strings.CutPrefix(e.Name(), base)
+		if ok && suffix.MatchString(rest) {
+			matches = append(matches, dir+e.Name())
+		}
+	}
+	if w.cfg.timestamp {
+		// the timestamps sort in the same order as the time
+		sort.Sort(sort.Reverse(sort.StringSlice(matches)))
+		return matches, nil
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return backupNumber(w.path, matches[i]) < backupNumber(w.path, matches[j])
+	})
+	return matches, nil
+}
+
+// a helper function that returns the number of a backup (3 for app.log.3.gz)
+func backupNumber(path, backup string) int {
+	var n int
+	fmt.Sscanf(strings.TrimPrefix(backup, path+"."), "%d", &n)
+	return n
+}
+
+// method that renames app.log.N to app.log.N+1, starting with the oldest
+func (w *rotatingWriter) shiftBackups() error {
+	backups, err := w.backups()
+	if err != nil {
+		return err
+	}
+	for i := len(backups) - 1; i >= 0; i-- {
+		n := backupNumber(w.path, backups[i])
+		suffix := strings.TrimPrefix(backups[i], fmt.Sprintf("%s.%d", w.path, n))
+		newName := fmt.Sprintf("%s.%d%s", w.path, n+1, suffix)
+		if err := os.Rename(backups[i], newName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// method that removes the oldest backups
+func (w *rotatingWriter) prune() error {
+	if w.cfg.maxBackups <= 0 {
+		return nil
+	}
+	backups, err := w.backups()
+	if err != nil {
+		return err
+	}
+	for i := w.cfg.maxBackups; i < len(backups); i++ {
+		if err := os.Remove(backups[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close method makes *rotatingWriter an io.WriteCloser
+func (w *rotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// a function that compresses a file to file.gz and removes the original
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func main() {
+	dir, err := os.MkdirTemp("", "logs")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// ROTATING BY SIZE, KEEPING 3 COMPRESSED BACKUPS
+	// app.log.old is not a backup: it's neither renamed nor removed
+	if err := os.WriteFile(filepath.Join(dir, "app.log.old"), []byte("keep me"), 0644); err != nil {
+		log.Fatal(err)
+	}
+	w, err := newRotatingWriter(filepath.Join(dir, "app.log"), rotateConfig{
+		maxSize:    1024,
+		compress:   true,
+		maxBackups: 3,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the writer is used by a logger instead of os.Stderr
+	logger := log.New(w, "", log.LstdFlags)
+
+	// writing from many goroutines at the same time
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				logger.Printf("goroutine %d, message %d\n", i, j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	w.Close()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, e := range entries {
+		fileInfo, _ := e.Info()
+		fmt.Println(e.Name(), fileInfo.Size())
+	}
+	// => app.log 698
+	// => app.log.1.gz 130
+	// => app.log.2.gz 132
+	// => app.log.3.gz 130
+	// => app.log.old 7
+
+	// ROTATING BY LINE COUNT WITH TIMESTAMPED NAMES (the [ ] in the name are not a glob pattern)
+	w, err = newRotatingWriter(filepath.Join(dir, "lines[1].log"), rotateConfig{maxLines: 2, timestamp: true})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		fmt.Fprintf(w, "line %d\n", i)
+	}
+	w.Close()
+
+	backups, _ := w.backups()
+	fmt.Println("Rotated files:", len(backups)) // => Rotated files: 2
+
+	// A FAILING COMPRESSION DOESN'T STOP THE LOGGING
+	// a stopped clock and a directory named like the compressed backup: gzipFile() can't create it
+	if err := os.Mkdir(filepath.Join(dir, "gz.log.20191021-162616.000000000.gz"), 0755); err != nil {
+		log.Fatal(err)
+	}
+	w, err = newRotatingWriter(filepath.Join(dir, "gz.log"), rotateConfig{maxLines: 1, timestamp: true, compress: true})
+	if err != nil {
+		log.Fatal(err)
+	}
+	w.now = func() time.Time { return time.Date(2019, 10, 21, 16, 26, 16, 0, time.UTC) }
+	w.onError = func(err error) {
+		fmt.Println("not fatal:", strings.ReplaceAll(err.Error(), dir+string(filepath.Separator), ""))
+	}
+	for i := 1; i <= 2; i++ {
+		if _, err := fmt.Fprintf(w, "line %d\n", i); err != nil {
+			log.Fatal(err)
+		}
+	}
+	w.Close()
+	// => not fatal: open gz.log.20191021-162616.000000000.gz: is a directory
+	data, _ := os.ReadFile(filepath.Join(dir, "gz.log"))
+	fmt.Printf("gz.log: %q\n", data) // => gz.log: "line 2\n"
+}
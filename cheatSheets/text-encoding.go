@@ -0,0 +1,523 @@
+/////////////////////////////////
+// Detecting Text Encodings and Converting Them to UTF-8
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+// Execute: go run text-encoding.go
+// The tests convert ţară, 中文维基是世界上 and other fixtures to every encoding and back.
+// Execute: go test -v text-encoding.go text-encoding_test.go
+
+// Converting a file (the result is written to standard output):
+// go run text-encoding.go [-from auto] [-to utf-8] [-bom] <file>
+// Encodings: utf-8, utf-16le, utf-16be, utf-32le, utf-32be, iso-8859-1, windows-1252
+
+// Go strings are UTF-8 encoded, but a file can use any encoding and os.ReadFile() returns its raw bytes.
+// A UTF-16 file read as UTF-8 looks like "h\x00e\x00l\x00l\x00o\x00" and a Latin-1 file has invalid runes.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// declaring a defined type for the encodings
+type encoding string
+
+const (
+	encUTF8        encoding = "utf-8"
+	encUTF16LE     encoding = "utf-16le"
+	encUTF16BE     encoding = "utf-16be"
+	encUTF32LE     encoding = "utf-32le"
+	encUTF32BE     encoding = "utf-32be"
+	encLatin1      encoding = "iso-8859-1"
+	encWindows1252 encoding = "windows-1252"
+)
+
+// the byte order marks (BOM) are the character U+FEFF encoded at the start of the file.
+// The UTF-32LE BOM starts with the UTF-16LE one, so it must be checked first.
+var boms = []struct {
+	bom []byte
+	enc encoding
+}{
+	{[]byte{0xFF, 0xFE, 0x00, 0x00}, encUTF32LE},
+	{[]byte{0x00, 0x00, 0xFE, 0xFF}, encUTF32BE},
+	{[]byte{0xEF, 0xBB, 0xBF}, encUTF8},
+	{[]byte{0xFF, 0xFE}, encUTF16LE},
+	{[]byte{0xFE, 0xFF}, encUTF16BE},
+}
+
+// Windows-1252 is ISO-8859-1 with printable characters instead of control codes in 0x80-0x9F.
+// The 5 unused codes (0x81, 0x8D, 0x8F, 0x90, 0x9D) are mapped to the same code point, like Windows does.
+var windows1252 = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+// the error returned for an unknown encoding name
+var errUnknownEncoding = errors.New("unknown encoding")
+
+func parseEncoding(name string) (encoding, error) {
+	switch e := encoding(strings.ToLower(name)); e {
+	case encUTF8, encUTF16LE, encUTF16BE, encUTF32LE, encUTF32BE, encLatin1, encWindows1252:
+		return e, nil
+	case "latin1", "latin-1":
+		return encLatin1, nil
+	case "cp1252":
+		return encWindows1252, nil
+	}
+	return "", fmt.Errorf("%w: %q", errUnknownEncoding, name)
+}
+
+/////////////////////////////////
+// Detecting the Encoding
+/////////////////////////////////
+
+// declaring a function that guesses the encoding of the first bytes of a file (the sample).
+// it returns the length of the BOM, which must be skipped.
+// Without a BOM the guess is based on zero bytes: ASCII text in UTF-16LE is "h\x00i\x00".
+// UTF-16 text without ASCII characters (like Chinese) has no zero bytes: see utf16Score().
+func detect(sample []byte) (enc encoding, bomLen int) {
+	for _, b := range boms {
+		if bytes.HasPrefix(sample, b.bom) {
+			return b.enc, len(b.bom)
+		}
+	}
+
+	// counting the zero bytes at each position modulo 4
+	var zeros [4]int
+	for i, b := range sample {
+		if b == 0 {
+			zeros[i%4]++
+		}
+	}
+	n := len(sample)
+	if n >= 4 {
+		quarter := n / 4
+		if zeros[2] == quarter && zeros[3] == quarter && zeros[0] < quarter {
+			return encUTF32LE, 0
+		}
+		if zeros[0] == quarter && zeros[1] == quarter && zeros[3] < quarter {
+			return encUTF32BE, 0
+		}
+	}
+	if n >= 2 {
+		even, odd := zeros[0]+zeros[2], zeros[1]+zeros[3]
+		if odd >= n/4 && even*4 < odd {
+			return encUTF16LE, 0
+		}
+		if even >= n/4 && odd*4 < even {
+			return encUTF16BE, 0
+		}
+	}
+
+	// the sample may end in the middle of a UTF-8 sequence, ignoring that incomplete last character
+	valid := sample
+	for i := len(sample) - 1; i >= 0 && i >= len(sample)-3; i-- {
+		if utf8.RuneStart(sample[i]) {
+			if !utf8.FullRune(sample[i:]) {
+				valid = sample[:i]
+			}
+			break
+		}
+	}
+	if utf8.Valid(valid) && bytes.IndexByte(valid, 0) < 0 {
+		return encUTF8, 0
+	}
+
+	// not UTF-8: it may be UTF-16 without a BOM and without ASCII characters
+	le, be := utf16Score(sample, binary.LittleEndian), utf16Score(sample, binary.BigEndian)
+	if le >= minUTF16Score && le >= be {
+		return encUTF16LE, 0
+	}
+	if be >= minUTF16Score {
+		return encUTF16BE, 0
+	}
+
+	// an 8-bit encoding: the bytes 0x80-0x9F are control codes in ISO-8859-1, they are rare in real text
+	for _, b := range sample {
+		if b >= 0x80 && b <= 0x9F {
+			return encWindows1252, 0
+		}
+	}
+	return encLatin1, 0
+}
+
+// the share of the characters that must belong to the same script for a sample to be UTF-16
+const minUTF16Score = 0.9
+
+// declaring a function that returns how plausible it is that the sample is UTF-16 text, from 0 to 1.
+// Every 2 bytes of any text are a valid code unit, so validity is not enough ("Bush hid the facts" in
+// ASCII is valid Chinese UTF-16). Real text uses printable characters, well-formed surrogate pairs
+// and mostly a single script (Han, Latin, Cyrillic...): the score is the share of the letters of the
+// most used script, 0 if a character is not printable or a surrogate is alone.
+// Pairs of ASCII characters are common Han characters in UTF-16BE, so ASCII text is rejected first.
+func utf16Score(sample []byte, order binary.ByteOrder) float64 {
+	units := make([]uint16, len(sample)/2)
+	if len(units) == 0 {
+		return 0
+	}
+	asciiPairs := 0
+	for i := range units {
+		units[i] = order.Uint16(sample[2*i:])
+		if isASCIIText(sample[2*i]) && isASCIIText(sample[2*i+1]) {
+			asciiPairs++
+		}
+	}
+	// in Chinese UTF-16 about 1 unit in 5 is made of 2 ASCII bytes, in English text almost all of them
+	if asciiPairs*2 > len(units) {
+		return 0
+	}
+	// the sample may end between the two units of a surrogate pair
+	if last := rune(units[len(units)-1]); last >= 0xD800 && last < 0xDC00 {
+		units = units[:len(units)-1]
+	}
+
+	scripts := make(map[string]int)
+	letters := 0
+	for _, r := range utf16.Decode(units) {
+		switch {
+		case r == utf8.RuneError:
+			return 0 // a lone surrogate
+		case r == '\n' || r == '\r' || r == '\t' || r == ' ':
+			continue
+		case !unicode.IsPrint(r):
+			return 0 // a control character or an unassigned code point
+		}
+		if unicode.IsLetter(r) {
+			letters++
+			scripts[scriptOf(r)]++
+		}
+	}
+	if letters == 0 {
+		return 0
+	}
+	most := 0
+	for _, n := range scripts {
+		most = max(most, n)
+	}
+	return float64(most) / float64(letters)
+}
+
+// declaring a function that reports whether a byte is a printable ASCII character or a space
+func isASCIIText(b byte) bool {
+	return b >= 0x20 && b < 0x7F || b == '\n' || b == '\r' || b == '\t'
+}
+
+// declaring a function that returns the name of the script of a letter: "Han", "Latin", ...
+func scriptOf(r rune) string {
+	for name, table := range unicode.Scripts {
+		if unicode.Is(table, r) {
+			return name
+		}
+	}
+	return ""
+}
+
+/////////////////////////////////
+// Decoding: any Encoding -> UTF-8 (a streaming io.Reader)
+/////////////////////////////////
+
+// declaring a struct type that implements io.Reader
+// it reads one character at a time from the source and returns it encoded as UTF-8.
+type decoder struct {
+	src *bufio.Reader
+	enc encoding
+	out []byte // UTF-8 bytes decoded but not returned yet
+	err error
+
+	unread    uint16 // a UTF-16 unit read too early, it's decoded first by the next readRune()
+	hasUnread bool
+}
+
+// declaring a function that returns a reader that converts src to UTF-8
+// if enc is "" the encoding is detected from the first 4 KB.
+func newDecoder(src io.Reader, enc encoding) (*decoder, encoding) {
+	bufferedReader := bufio.NewReaderSize(src, 4096)
+	sample, _ := bufferedReader.Peek(4096)
+	detected, bomLen := detect(sample)
+	if enc == "" {
+		enc = detected
+	} else if detected != enc {
+		bomLen = 0 // the BOM of another encoding is not a BOM
+	}
+	bufferedReader.Discard(bomLen)
+	return &decoder{src: bufferedReader, enc: enc}, enc
+}
+
+// method that reads one character from the source
+func (d *decoder) readRune() (rune, error) {
+	switch d.enc {
+	case encUTF8:
+		r, _, err := d.src.ReadRune() // invalid bytes become utf8.RuneError (U+FFFD)
+		return r, err
+	case encLatin1:
+		b, err := d.src.ReadByte()
+		return rune(b), err // ISO-8859-1 bytes are the first 256 Unicode code points
+	case encWindows1252:
+		b, err := d.src.ReadByte()
+		if b >= 0x80 && b <= 0x9F {
+			return windows1252[b-0x80], err
+		}
+		return rune(b), err
+	case encUTF16LE, encUTF16BE:
+		u1, err := d.readUnit16()
+		if err != nil {
+			return 0, err
+		}
+		r := rune(u1)
+		if r >= 0xDC00 && r < 0xE000 {
+			return utf8.RuneError, nil // a low surrogate without a high one
+		}
+		if r >= 0xD800 && r < 0xDC00 {
+			// characters outside the BMP (like emoji) are encoded as 2 units: a high and a low surrogate
+			u2, err := d.readUnit16()
+			if err != nil {
+				return utf8.RuneError, nil
+			}
+			if u2 < 0xDC00 || u2 >= 0xE000 {
+				// not a low surrogate: the high one is invalid, but u2 is a character of its own
+				d.unread, d.hasUnread = u2, true
+				return utf8.RuneError, nil
+			}
+			r = utf16.DecodeRune(r, rune(u2))
+		}
+		return r, nil
+	case encUTF32LE, encUTF32BE:
+		u, err := d.readUnit(4)
+		if err != nil {
+			return 0, err
+		}
+		if !utf8.ValidRune(rune(u)) {
+			return utf8.RuneError, nil
+		}
+		return rune(u), nil
+	}
+	return 0, errUnknownEncoding
+}
+
+// method that returns the UTF-16 unit read too early, or reads the next one
+func (d *decoder) readUnit16() (uint16, error) {
+	if d.hasUnread {
+		d.hasUnread = false
+		return d.unread, nil
+	}
+	u, err := d.readUnit(2)
+	return uint16(u), err
+}
+
+// method that reads a 2 or 4 bytes code unit in the byte order of the encoding
+func (d *decoder) readUnit(size int) (uint32, error) {
+	var b [4]byte
+	n, err := io.ReadFull(d.src, b[:size])
+	if err == io.ErrUnexpectedEOF || (err == io.EOF && n > 0) {
+		return uint32(utf8.RuneError), nil // a truncated last character
+	}
+	if err != nil {
+		return 0, err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if d.enc == encUTF16BE || d.enc == encUTF32BE {
+		order = binary.BigEndian
+	}
+	if size == 2 {
+		return uint32(order.Uint16(b[:2])), nil
+	}
+	return order.Uint32(b[:4]), nil
+}
+
+// Read method makes *decoder an io.Reader
+func (d *decoder) Read(p []byte) (int, error) {
+	for len(d.out) < len(p) && d.err == nil {
+		r, err := d.readRune()
+		if err != nil {
+			d.err = err
+			break
+		}
+		d.out = utf8.AppendRune(d.out, r)
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	if n == 0 && d.err != nil {
+		return 0, d.err
+	}
+	return n, nil
+}
+
+/////////////////////////////////
+// Encoding: UTF-8 -> any Encoding (a streaming io.Writer)
+/////////////////////////////////
+
+// declaring a struct type that implements io.Writer
+// characters that can't be represented in the target encoding are written as '?'.
+type encoder struct {
+	dst     io.Writer
+	enc     encoding
+	partial []byte // the start of a UTF-8 sequence split between two Write() calls
+}
+
+// declaring a function that returns a writer that converts UTF-8 to enc
+func newEncoder(dst io.Writer, enc encoding, writeBOM bool) (*encoder, error) {
+	e := &encoder{dst: dst, enc: enc}
+	if writeBOM {
+		for _, b := range boms {
+			if b.enc == enc {
+				if _, err := dst.Write(b.bom); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+	}
+	return e, nil
+}
+
+// Write method makes *encoder an io.Writer
+func (e *encoder) Write(p []byte) (int, error) {
+	data := append(e.partial, p...)
+	e.partial = nil
+	var out []byte
+	for len(data) > 0 {
+		if !utf8.FullRune(data) {
+			e.partial = append([]byte(nil), data...) // waiting for the rest of the sequence
+			break
+		}
+		r, size := utf8.DecodeRune(data)
+		data = data[size:]
+		out = e.appendRune(out, r)
+	}
+	if _, err := e.dst.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// method that appends a character in the target encoding
+func (e *encoder) appendRune(out []byte, r rune) []byte {
+	switch e.enc {
+	case encUTF8:
+		return utf8.AppendRune(out, r)
+	case encLatin1:
+		if r > 0xFF {
+			r = '?'
+		}
+		return append(out, byte(r))
+	case encWindows1252:
+		if r >= 0x80 && r <= 0x9F || r > 0xFF {
+			// looking for the character in the 0x80-0x9F table
+			b := byte('?')
+			for i, c := range windows1252 {
+				if c == r {
+					b = byte(0x80 + i)
+				}
+			}
+			return append(out, b)
+		}
+		return append(out, byte(r))
+	case encUTF16LE:
+		for _, u := range utf16.Encode([]rune{r}) {
+			out = binary.LittleEndian.AppendUint16(out, u)
+		}
+		return out
+	case encUTF16BE:
+		for _, u := range utf16.Encode([]rune{r}) {
+			out = binary.BigEndian.AppendUint16(out, u)
+		}
+		return out
+	case encUTF32LE:
+		return binary.LittleEndian.AppendUint32(out, uint32(r))
+	case encUTF32BE:
+		return binary.BigEndian.AppendUint32(out, uint32(r))
+	}
+	return out
+}
+
+func main() {
+	from := flag.String("from", "auto", "the encoding of the input")
+	to := flag.String("to", "utf-8", "the encoding of the output")
+	bom := flag.Bool("bom", false, "write a byte order mark (UTF-8, UTF-16 and UTF-32 only)")
+	flag.Parse()
+
+	// CONVERTING A FILE
+	if flag.NArg() > 0 {
+		var fromEnc encoding
+		if *from != "auto" {
+			e, err := parseEncoding(*from)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fromEnc = e
+		}
+		toEnc, err := parseEncoding(*to)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		file, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+
+		dec, detected := newDecoder(file, fromEnc)
+		log.Printf("%s: %s -> %s\n", flag.Arg(0), detected, toEnc)
+
+		bufferedWriter := bufio.NewWriter(os.Stdout)
+		enc, err := newEncoder(bufferedWriter, toEnc, *bom)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// io.Copy() streams the file, it's never loaded into memory as a whole
+		if _, err := io.Copy(enc, dec); err != nil {
+			log.Fatal(err)
+		}
+		if err := bufferedWriter.Flush(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// ROUND TRIPS: encoding text and detecting the encoding back (text-encoding_test.go tries all the encodings)
+	texts := []struct {
+		text string
+		enc  encoding
+	}{
+		{"ţară", encUTF16LE},
+		{"中文维基是世界上", encUTF16BE},
+		{"Größe: 5 €", encWindows1252},
+		{"Größe: 5 mm", encLatin1},
+	}
+	for _, t := range texts {
+		var buf bytes.Buffer
+		e, _ := newEncoder(&buf, t.enc, false)
+		io.WriteString(e, t.text)
+		raw := buf.Bytes()
+
+		d, detected := newDecoder(bytes.NewReader(raw), "")
+		decoded, _ := io.ReadAll(d)
+		fmt.Printf("%-12s % -24x -> detected: %-12s %q\n", t.enc, raw[:min(len(raw), 8)], detected, decoded)
+	}
+	// => utf-16le     63 01 61 00 72 00 03 01  -> detected: utf-16le     "ţară"
+	// => utf-16be     4e 2d 65 87 7e f4 57 fa  -> detected: utf-16be     "中文维基是世界上"
+	// => windows-1252 47 72 f6 df 65 3a 20 35  -> detected: windows-1252 "Größe: 5 €"
+	// => iso-8859-1   47 72 f6 df 65 3a 20 35  -> detected: iso-8859-1   "Größe: 5 mm"
+
+	// A BROKEN SURROGATE PAIR: the high surrogate D83D is followed by 'A', not by a low surrogate
+	d, _ := newDecoder(bytes.NewReader([]byte{0x3D, 0xD8, 0x41, 0x00, 0x42, 0x00}), encUTF16LE)
+	decoded, _ := io.ReadAll(d)
+	fmt.Printf("%q\n", decoded) // => "\ufffdAB"
+}
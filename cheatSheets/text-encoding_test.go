@@ -0,0 +1,107 @@
+/////////////////////////////////
+// Tests: Round Trips Through Every Encoding
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Execute: go test -v text-encoding.go text-encoding_test.go
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// the fixtures: every text uses only characters its encodings can represent
+// (ţ and 中 are not in ISO-8859-1 or Windows-1252, they would come back as '?')
+var roundTrips = []struct {
+	text string
+	encs []encoding
+}{
+	{"ţară", []encoding{encUTF8, encUTF16LE, encUTF16BE, encUTF32LE, encUTF32BE}},
+	{"中文维基是世界上", []encoding{encUTF8, encUTF16LE, encUTF16BE, encUTF32LE, encUTF32BE}},
+	{"I learn Golang! €", []encoding{encUTF8, encUTF16LE, encUTF16BE, encUTF32LE, encUTF32BE, encWindows1252}},
+	{"Größe: 5 mm, café", []encoding{encUTF8, encUTF16LE, encUTF16BE, encUTF32LE, encUTF32BE, encLatin1}},
+}
+
+// a helper function that encodes text
+func encode(t *testing.T, text string, enc encoding, bom bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	e, err := newEncoder(&buf, enc, bom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(e, text); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, rt := range roundTrips {
+		for _, enc := range rt.encs {
+			for _, bom := range []bool{false, true} {
+				if bom && (enc == encLatin1 || enc == encWindows1252) {
+					continue // 8-bit encodings have no BOM
+				}
+				raw := encode(t, rt.text, enc, bom)
+				d, detected := newDecoder(bytes.NewReader(raw), "")
+				decoded, err := io.ReadAll(d)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if detected != enc {
+					t.Errorf("%q in %s (BOM %v): detected %s", rt.text, enc, bom, detected)
+				}
+				if string(decoded) != rt.text {
+					t.Errorf("%q in %s (BOM %v): decoded %q", rt.text, enc, bom, decoded)
+				}
+			}
+		}
+	}
+}
+
+func TestDetectWithoutBOM(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample []byte
+		want   encoding
+	}{
+		{"UTF-16LE Chinese, no zero byte", []byte{0x2D, 0x4E, 0x87, 0x65, 0xF4, 0x7E, 0xFA, 0x57}, encUTF16LE},
+		{"UTF-16BE Chinese, no zero byte", []byte{0x4E, 0x2D, 0x65, 0x87, 0x7E, 0xF4, 0x57, 0xFA}, encUTF16BE},
+		{"UTF-16LE emoji (a surrogate pair)", []byte{0x3D, 0xD8, 0x03, 0xDE, 0x2D, 0x4E, 0x87, 0x65}, encUTF16LE},
+		{"ASCII is not UTF-16", []byte("Bush hid the facts"), encUTF8},
+		{"Windows-1252 is not UTF-16", []byte("I learn Golang! \x80"), encWindows1252},
+		{"Latin-1 is not UTF-16", []byte("Gr\xf6\xdfe: 5 mm"), encLatin1},
+	}
+	for _, tt := range tests {
+		if got, bomLen := detect(tt.sample); got != tt.want || bomLen != 0 {
+			t.Errorf("%s: detect() = %s, %d, want %s, 0", tt.name, got, bomLen, tt.want)
+		}
+	}
+}
+
+func TestUnpairedSurrogates(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+		want string
+	}{
+		{"high surrogate followed by a character", []byte{0x3D, 0xD8, 0x41, 0x00, 0x42, 0x00}, "�AB"},
+		{"two high surrogates, then a low one", []byte{0x3D, 0xD8, 0x3D, 0xD8, 0x00, 0xDE}, "�😀"},
+		{"low surrogate alone", []byte{0x00, 0xDE, 0x41, 0x00}, "�A"},
+		{"high surrogate at the end", []byte{0x41, 0x00, 0x3D, 0xD8}, "A�"},
+	}
+	for _, tt := range tests {
+		d, _ := newDecoder(bytes.NewReader(tt.raw), encUTF16LE)
+		got, err := io.ReadAll(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
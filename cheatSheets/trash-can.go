@@ -0,0 +1,451 @@
+/////////////////////////////////
+// A Trash Can Instead of os.Remove() (the freedesktop.org Trash specification)
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+// The trash is the same one used by the Linux desktops (GNOME Files, Dolphin, ...).
+
+// Execute:
+// go run trash-can.go put a.txt b.txt       moves the files to the trash
+// go run trash-can.go list                  lists the trashed files
+// go run trash-can.go restore a.txt         restores a file to its original path (the name shown by list)
+// go run trash-can.go empty [-days 30]      removes the trashed files for good (or only the older ones)
+
+// A trash directory has two subdirectories:
+// files/  the trashed files and directories, with the name they got in the trash
+// info/   a <name>.trashinfo file for each of them:
+//         [Trash Info]
+//         Path=/home/andrei/a.txt
+//         DeletionDate=2019-10-21T16:26:16
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// the format of DeletionDate: local time without a time zone
+const dateLayout = "2006-01-02T15:04:05"
+
+// declaring a struct type for a trash directory
+type trashDir struct {
+	path   string
+	topdir string // for a trash on another file system: its mount point (Path= is relative to it)
+}
+
+func (t trashDir) filesDir() string { return filepath.Join(t.path, "files") }
+func (t trashDir) infoDir() string  { return filepath.Join(t.path, "info") }
+
+// declaring a struct type for a trashed file
+type trashedFile struct {
+	trash    trashDir
+	name     string // the name in files/
+	origPath string
+	deleted  time.Time
+}
+
+/////////////////////////////////
+// Finding the Trash Directories
+/////////////////////////////////
+
+// the home trash is $XDG_DATA_HOME/Trash, by default ~/.local/share/Trash
+func homeTrash() (trashDir, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return trashDir{}, err
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return trashDir{path: filepath.Join(dataHome, "Trash")}, nil
+}
+
+// a helper function that returns the device of a path (the file system it's on)
+func device(path string) (uint64, error) {
+	fileInfo, err := os.Lstat(path)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(fileInfo.Sys().(*syscall.Stat_t).Dev), nil
+}
+
+// declaring a function that finds the mount point of a path: the highest directory on the same device
+func mountPoint(path string) (string, error) {
+	dev, err := device(path)
+	if err != nil {
+		return "", err
+	}
+	for {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path, nil // reached /
+		}
+		parentDev, err := device(parent)
+		if err != nil {
+			return "", err
+		}
+		if parentDev != dev {
+			return path, nil
+		}
+		path = parent
+	}
+}
+
+// declaring a function that returns the trash to use for a file on another file system:
+// 1. $topdir/.Trash/$uid if the administrator created $topdir/.Trash (a sticky directory, not a symlink)
+// 2. otherwise $topdir/.Trash-$uid, created if needed
+func topdirTrash(topdir string, create bool) (trashDir, bool) {
+	uid := strconv.Itoa(os.Getuid())
+
+	shared := filepath.Join(topdir, ".Trash")
+	if fileInfo, err := os.Lstat(shared); err == nil &&
+		fileInfo.IsDir() && fileInfo.Mode()&os.ModeSticky != 0 && fileInfo.Mode()&os.ModeSymlink == 0 {
+		t := trashDir{path: filepath.Join(shared, uid), topdir: topdir}
+		if !create || os.MkdirAll(t.infoDir(), 0700) == nil && os.MkdirAll(t.filesDir(), 0700) == nil {
+			if _, err := os.Stat(t.path); err == nil {
+				return t, true
+			}
+		}
+	}
+
+	t := trashDir{path: filepath.Join(topdir, ".Trash-"+uid), topdir: topdir}
+	if create {
+		if err := os.MkdirAll(t.infoDir(), 0700); err != nil {
+			return trashDir{}, false
+		}
+		if err := os.MkdirAll(t.filesDir(), 0700); err != nil {
+			return trashDir{}, false
+		}
+	}
+	if _, err := os.Stat(t.path); err != nil {
+		return trashDir{}, false
+	}
+	return t, true
+}
+
+// declaring a function that picks the trash for a file: the home trash if the file is on the same
+// file system (a rename is enough), otherwise the trash at the top of the file's file system.
+func trashFor(path string) (trashDir, error) {
+	home, err := homeTrash()
+	if err != nil {
+		return trashDir{}, err
+	}
+	if err := os.MkdirAll(home.infoDir(), 0700); err != nil {
+		return trashDir{}, err
+	}
+	if err := os.MkdirAll(home.filesDir(), 0700); err != nil {
+		return trashDir{}, err
+	}
+
+	fileDev, err := device(filepath.Dir(path))
+	if err != nil {
+		return trashDir{}, err
+	}
+	homeDev, err := device(home.path)
+	if err != nil {
+		return trashDir{}, err
+	}
+	if fileDev == homeDev {
+		return home, nil
+	}
+
+	topdir, err := mountPoint(filepath.Dir(path))
+	if err != nil {
+		return trashDir{}, err
+	}
+	t, ok := topdirTrash(topdir, true)
+	if !ok {
+		return trashDir{}, fmt.Errorf("%s: no usable trash directory on %s", path, topdir)
+	}
+	return t, nil
+}
+
+// declaring a function that returns every existing trash directory: the home one and one per mount point
+func allTrashes() ([]trashDir, error) {
+	home, err := homeTrash()
+	if err != nil {
+		return nil, err
+	}
+	trashes := []trashDir{home}
+
+	// /proc/self/mounts lists the mounted file systems: "device mountpoint type options 0 0"
+	file, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return trashes, nil
+	}
+	defer file.Close()
+	seen := map[string]bool{home.path: true}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		topdir := strings.ReplaceAll(fields[1], `\040`, " ") // spaces are escaped in octal
+		if t, ok := topdirTrash(topdir, false); ok && !seen[t.path] {
+			seen[t.path] = true
+			trashes = append(trashes, t)
+		}
+	}
+	return trashes, scanner.Err()
+}
+
+/////////////////////////////////
+// put, list, restore, empty
+/////////////////////////////////
+
+// declaring a function that moves a file or directory to the trash
+func put(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(abs); err != nil {
+		return err
+	}
+	t, err := trashFor(abs)
+	if err != nil {
+		return err
+	}
+
+	// Path= is absolute for the home trash and relative to the mount point for the other ones;
+	// it's percent-encoded like a URL path ("my file.txt" -> "my%20file.txt")
+	origPath := abs
+	if t.topdir != "" {
+		if rel, err := filepath.Rel(t.topdir, abs); err == nil {
+			origPath = rel
+		}
+	}
+	info := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: origPath}).EscapedPath(), time.Now().Format(dateLayout))
+
+	// NAME COLLISIONS: the .trashinfo file is created with O_EXCL, so only one process can take a name.
+	// The name must be free in files/ too: a file can be left there without its info (a crash, another tool),
+	// and os.Rename() would silently replace it.
+	// If a.txt is already in the trash the next one becomes a.2.txt, then a.3.txt, ...
+	base := filepath.Base(abs)
+	ext := filepath.Ext(base)
+	for n := 1; ; n++ {
+		name := base
+		if n > 1 {
+			name = fmt.Sprintf("%s.%d%s", strings.TrimSuffix(base, ext), n, ext)
+		}
+		infoPath := filepath.Join(t.infoDir(), name+".trashinfo")
+		file, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		filesPath := filepath.Join(t.filesDir(), name)
+		if _, err := os.Lstat(filesPath); !errors.Is(err, fs.ErrNotExist) {
+			// an orphan in files/ (or an error): keeping it and trying the next name
+			file.Close()
+			os.Remove(infoPath)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		_, err = file.WriteString(info)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(abs, filesPath)
+		}
+		if err != nil {
+			os.Remove(infoPath) // the file was not trashed, so it must not be listed
+			return err
+		}
+		return nil
+	}
+}
+
+// declaring a function that parses a .trashinfo file
+func readInfo(t trashDir, infoName string) (trashedFile, error) {
+	f := trashedFile{trash: t, name: strings.TrimSuffix(infoName, ".trashinfo")}
+	data, err := os.ReadFile(filepath.Join(t.infoDir(), infoName))
+	if err != nil {
+		return f, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Path":
+			p, err := url.PathUnescape(value)
+			if err != nil {
+				return f, err
+			}
+			if !filepath.IsAbs(p) && t.topdir != "" {
+				p = filepath.Join(t.topdir, p)
+			}
+			f.origPath = p
+		case "DeletionDate":
+			f.deleted, _ = time.ParseInLocation(dateLayout, value, time.Local)
+		}
+	}
+	if f.origPath == "" {
+		return f, fmt.Errorf("%s: no Path", infoName)
+	}
+	return f, nil
+}
+
+// declaring a function that lists the trashed files of all the trash directories, oldest first
+func list() ([]trashedFile, error) {
+	trashes, err := allTrashes()
+	if err != nil {
+		return nil, err
+	}
+	var files []trashedFile
+	for _, t := range trashes {
+		entries, err := os.ReadDir(t.infoDir())
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !strings.HasSuffix(e.Name(), ".trashinfo") {
+				continue
+			}
+			f, err := readInfo(t, e.Name())
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].deleted.Before(files[j].deleted) })
+	return files, nil
+}
+
+// declaring a function that restores a trashed file, found by its trash name or its original path.
+// it never overwrites: if the original path exists again the file stays in the trash.
+func restore(nameOrPath string) error {
+	files, err := list()
+	if err != nil {
+		return err
+	}
+	abs, _ := filepath.Abs(nameOrPath)
+
+	// the most recently deleted match wins
+	for i := len(files) - 1; i >= 0; i-- {
+		f := files[i]
+		if f.name != nameOrPath && f.origPath != abs {
+			continue
+		}
+		if _, err := os.Lstat(f.origPath); err == nil {
+			return fmt.Errorf("%s: %w", f.origPath, fs.ErrExist)
+		}
+		if err := os.MkdirAll(filepath.Dir(f.origPath), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(f.trash.filesDir(), f.name), f.origPath); err != nil {
+			return err
+		}
+		return os.Remove(filepath.Join(f.trash.infoDir(), f.name+".trashinfo"))
+	}
+	return fmt.Errorf("%s: not in the trash", nameOrPath)
+}
+
+// declaring a function that deletes the trashed files older than the given age (0 means all)
+func empty(olderThan time.Duration) (int, error) {
+	files, err := list()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, f := range files {
+		if olderThan > 0 && time.Since(f.deleted) < olderThan {
+			continue
+		}
+		// the file is removed before its info: a file without info is invisible, an info without file is an error
+		if err := os.RemoveAll(filepath.Join(f.trash.filesDir(), f.name)); err != nil {
+			return removed, err
+		}
+		if err := os.Remove(filepath.Join(f.trash.infoDir(), f.name+".trashinfo")); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func main() {
+	log.SetFlags(0)
+	usage := "usage: trash-can.go put <files...> | list | restore <name-or-path> | empty [-days n]"
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	switch os.Args[1] {
+	case "put":
+		if len(os.Args) < 3 {
+			log.Fatal(usage)
+		}
+		failed := false
+		for _, p := range os.Args[2:] {
+			if err := put(p); err != nil {
+				log.Println(err)
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+
+	case "list":
+		files, err := list()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, f := range files {
+			fmt.Printf("%s  %-20s %s\n", f.deleted.Format("2006-01-02 15:04:05"), f.name, f.origPath)
+		}
+		// => 2019-10-21 16:26:16  a.txt                /home/andrei/a.txt
+		// => 2019-10-21 16:30:59  a.2.txt              /home/andrei/a.txt
+
+	case "restore":
+		if len(os.Args) != 3 {
+			log.Fatal(usage)
+		}
+		if err := restore(os.Args[2]); err != nil {
+			log.Fatal(err)
+		}
+
+	case "empty":
+		cmd := flag.NewFlagSet("empty", flag.ExitOnError)
+		days := cmd.Int("days", 0, "remove only the files trashed more than this many days ago")
+		cmd.Parse(os.Args[2:])
+		n, err := empty(time.Duration(*days) * 24 * time.Hour)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Removed:", n)
+
+	default:
+		log.Fatal(usage)
+	}
+}
@@ -0,0 +1,356 @@
+/////////////////////////////////
+// A Generic Worker Pool
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Run this program on your local machine (not in Go Playground)
+// Execute: go run worker-pool.go
+// The benchmarks compare the pool with the loop of channels.go:
+// Execute: go test -v -bench . worker-pool.go worker-pool_test.go
+
+// channels.go computes the factorials like this:
+//	for i := 1; i <= 20; i++ {
+//		go factorial(i, ch)
+//		f := <-ch // waiting for the goroutine before starting the next one
+//	}
+// Only one goroutine runs at a time, so the loop is NOT concurrent.
+// A worker pool runs a fixed number of goroutines (the workers) that take jobs from a queue:
+// - the number of workers limits the CPU, memory or connections used at the same time
+// - the queue is bounded: Submit() blocks when it's full (backpressure) instead of using more and more memory
+// - results come back in the order of submission, or as soon as they're ready
+// - errors and panics of a job become results, the context cancels the jobs that didn't start and closes the pool
+// - Close() lets the workers finish the queued jobs (graceful drain)
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+/////////////////////////////////
+// The Pool
+/////////////////////////////////
+
+// declaring a struct type for the result of a job
+type result[T, R any] struct {
+	Index int // the position of the job in the order of submission
+	Input T
+	Value R
+	Err   error
+}
+
+// declaring a struct type for the error of a job that panicked
+type panicError struct {
+	value any
+	stack []byte
+}
+
+func (p *panicError) Error() string {
+	return fmt.Sprintf("job panicked: %v", p.value)
+}
+
+type job[T any] struct {
+	index int
+	input T
+}
+
+// declaring a generic struct type: T is the type of the jobs, R the type of the results
+type pool[T, R any] struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	fn       func(context.Context, T) (R, error)
+	failFast bool // cancel the other jobs after the first error
+
+	jobs     chan job[T]
+	inflight chan struct{} // a slot for every job submitted and not yet received: bounds the memory of the ordered mode
+	done     chan result[T, R]
+	results  chan result[T, R]
+
+	mu     sync.Mutex
+	next   int // the index of the next submitted job
+	closed bool
+	err    error // the first error of a job
+}
+
+var errPoolClosed = errors.New("pool is closed")
+
+// declaring a function that starts a pool of workers.
+// The results MUST be received from Results() while submitting, else Submit() blocks when the queue is full.
+func newPool[T, R any](ctx context.Context, workers, queueSize int, ordered, failFast bool, fn func(context.Context, T) (R, error)) *pool[T, R] {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &pool[T, R]{
+		ctx:      ctx,
+		cancel:   cancel,
+		fn:       fn,
+		failFast: failFast,
+		jobs:     make(chan job[T], queueSize),
+		inflight: make(chan struct{}, queueSize+workers),
+		done:     make(chan result[T, R]),
+		results:  make(chan result[T, R]),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range p.jobs {
+				p.done <- p.run(j)
+			}
+		}()
+	}
+	// when all the workers have returned, nothing more is sent to done
+	go func() {
+		wg.Wait()
+		close(p.done)
+	}()
+	// a cancelled pool is closed, otherwise the workers would wait forever for jobs if Close() is never called.
+	// The queued jobs are still received by the workers: they become results with the context error.
+	go func() {
+		<-p.ctx.Done()
+		p.Close()
+	}()
+
+	if ordered {
+		go p.reorder()
+	} else {
+		go func() {
+			for r := range p.done {
+				p.results <- r
+				<-p.inflight
+			}
+			close(p.results)
+			p.cancel() // releasing the resources of the context
+		}()
+	}
+	return p
+}
+
+// method that runs a single job, turning a panic into an error
+func (p *pool[T, R]) run(j job[T]) (r result[T, R]) {
+	r = result[T, R]{Index: j.index, Input: j.input}
+	// a job of a cancelled pool is not started
+	if err := p.ctx.Err(); err != nil {
+		r.Err = err
+		return r
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			r.Err = &panicError{v, debug.Stack()}
+		}
+		if r.Err != nil {
+			p.mu.Lock()
+			if p.err == nil {
+				p.err = r.Err
+			}
+			p.mu.Unlock()
+			if p.failFast {
+				p.cancel()
+			}
+		}
+	}()
+	r.Value, r.Err = p.fn(p.ctx, j.input)
+	return r
+}
+
+// method that sends the results in the order of submission.
+// A result that comes too early waits in a map; the inflight slots limit the size of the map.
+func (p *pool[T, R]) reorder() {
+	pending := make(map[int]result[T, R])
+	next := 0
+	for r := range p.done {
+		pending[r.Index] = r
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			p.results <- r
+			<-p.inflight
+			next++
+		}
+	}
+	close(p.results)
+	p.cancel()
+}
+
+// method that adds a job to the queue. It blocks while the queue is full.
+func (p *pool[T, R]) Submit(input T) error {
+	select {
+	case p.inflight <- struct{}{}:
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+	// the mutex makes the index and the send atomic: the jobs are queued in the order of their index
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		<-p.inflight
+		return errPoolClosed
+	}
+	p.jobs <- job[T]{p.next, input} // never blocks: there are fewer inflight slots than queue + workers
+	p.next++
+	return nil
+}
+
+// method that returns the channel of the results. It's closed after Close() when all the jobs are done.
+func (p *pool[T, R]) Results() <-chan result[T, R] {
+	return p.results
+}
+
+// method that stops accepting jobs; the queued jobs are still done (graceful drain)
+func (p *pool[T, R]) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+}
+
+// method that returns the first error of a job
+func (p *pool[T, R]) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// declaring a generic function that applies fn to all the inputs with a pool and returns the values in order.
+// It stops at the first error.
+func mapConcurrent[T, R any](ctx context.Context, workers int, inputs []T, fn func(context.Context, T) (R, error)) ([]R, error) {
+	p := newPool(ctx, workers, workers, true, true, fn)
+	go func() {
+		defer p.Close()
+		for _, in := range inputs {
+			if p.Submit(in) != nil {
+				return // cancelled by an error
+			}
+		}
+	}()
+	values := make([]R, 0, len(inputs))
+	for r := range p.Results() {
+		values = append(values, r.Value)
+	}
+	if err := p.Err(); err != nil {
+		return nil, err
+	}
+	return values, ctx.Err()
+}
+
+/////////////////////////////////
+// Examples
+/////////////////////////////////
+
+// declaring a function that computes n! with math/big: a CPU-bound job
+func factorial(n int) *big.Int {
+	f := big.NewInt(1)
+	for i := 2; i <= n; i++ {
+		f.Mul(f, big.NewInt(int64(i)))
+	}
+	return f
+}
+
+func main() {
+	ctx := context.Background()
+
+	// ORDERED RESULTS
+	p := newPool(ctx, 4, 8, true, false, func(ctx context.Context, n int) (string, error) {
+		time.Sleep(time.Duration(20-n) * time.Millisecond) // the last jobs finish first
+		return factorial(n).String(), nil
+	})
+	go func() {
+		defer p.Close()
+		for i := 1; i <= 20; i++ {
+			p.Submit(i)
+		}
+	}()
+	for r := range p.Results() {
+		if r.Input > 17 {
+			fmt.Printf("Factorial of %d: %s\n", r.Input, r.Value)
+		}
+	}
+	// => Factorial of 18: 6402373705728000
+	// => Factorial of 19: 121645100408832000
+	// => Factorial of 20: 2432902008176640000
+
+	// UNORDERED RESULTS: in the order they're done
+	p2 := newPool(ctx, 4, 8, false, false, func(ctx context.Context, ms int) (int, error) {
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+		return ms, nil
+	})
+	go func() {
+		defer p2.Close()
+		for _, d := range []int{40, 10, 30, 20} {
+			p2.Submit(d)
+		}
+	}()
+	for r := range p2.Results() {
+		fmt.Print(r.Index, ":", r.Value, " ")
+	}
+	fmt.Println() // => 1:10 3:20 2:30 0:40
+
+	// ERRORS AND PANICS
+	p3 := newPool(ctx, 2, 4, true, false, func(ctx context.Context, n int) (int, error) {
+		if n == 2 {
+			return 0, fmt.Errorf("invalid input %d", n)
+		}
+		if n == 3 {
+			var m map[string]int
+			m["boom"] = 1 // a panic in a job doesn't crash the program
+		}
+		return n * n, nil
+	})
+	go func() {
+		defer p3.Close()
+		for i := 1; i <= 4; i++ {
+			p3.Submit(i)
+		}
+	}()
+	for r := range p3.Results() {
+		fmt.Println(r.Input, r.Value, r.Err)
+	}
+	// => 1 1 <nil>
+	// => 2 0 invalid input 2
+	// => 3 0 job panicked: assignment to entry in nil map
+	// => 4 16 <nil>
+
+	// FAIL FAST: the first error cancels the jobs that didn't start
+	_, err := mapConcurrent(ctx, 2, []int{1, 2, 3, 4, 5, 6, 7, 8}, func(ctx context.Context, n int) (int, error) {
+		time.Sleep(10 * time.Millisecond)
+		if n == 3 {
+			return 0, errors.New("job 3 failed")
+		}
+		return n, nil
+	})
+	fmt.Println(err) // => job 3 failed
+
+	// CANCELLING: jobs started before the timeout finish, the queued ones get the context error
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	p4 := newPool(timeoutCtx, 2, 10, true, false, func(ctx context.Context, n int) (int, error) {
+		time.Sleep(40 * time.Millisecond)
+		return n, nil
+	})
+	go func() {
+		defer p4.Close()
+		for i := 0; i < 6; i++ {
+			if err := p4.Submit(i); err != nil {
+				return
+			}
+		}
+	}()
+	for r := range p4.Results() {
+		fmt.Print(r.Input, ":", r.Err, " ")
+	}
+	cancel()
+	fmt.Println()
+	// => 0:<nil> 1:<nil> 2:<nil> 3:<nil> 4:context deadline exceeded 5:context deadline exceeded
+
+	// SPEEDUP OVER THE LOOP OF channels.go: see the benchmarks in worker-pool_test.go
+}
@@ -0,0 +1,104 @@
+/////////////////////////////////
+// Benchmarks: the Pool and the Loop of channels.go
+/////////////////////////////////
+
+// ** IMPORTANT **//
+// Execute: go test -v -bench . worker-pool.go worker-pool_test.go
+
+// A CPU-bound job: the speedup of the pool is close to the number of CPUs (1 here, nothing runs in parallel).
+// An I/O-bound job (a 5ms request): the speedup is close to the number of workers (20).
+// => BenchmarkChannelsLoop/cpu      16      69264964 ns/op
+// => BenchmarkChannelsLoop/io        1    1035707528 ns/op
+// => BenchmarkPool/cpu              16      63984162 ns/op
+// => BenchmarkPool/io               22      52102112 ns/op
+
+package main
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// the number of jobs of an operation
+const benchJobs = 200
+
+var benchWork = []struct {
+	name    string
+	work    func(n int)
+	workers int
+}{
+	{"cpu", func(n int) { factorial(2000 + n) }, runtime.NumCPU()},
+	{"io", func(n int) { time.Sleep(5 * time.Millisecond) }, 20},
+}
+
+func BenchmarkChannelsLoop(b *testing.B) {
+	for _, bw := range benchWork {
+		b.Run(bw.name, func(b *testing.B) {
+			for b.Loop() {
+				ch := make(chan struct{})
+				for i := 0; i < benchJobs; i++ {
+					go func() { bw.work(i); ch <- struct{}{} }()
+					<-ch // the loop of channels.go
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPool(b *testing.B) {
+	for _, bw := range benchWork {
+		b.Run(bw.name, func(b *testing.B) {
+			for b.Loop() {
+				p := newPool(context.Background(), bw.workers, bw.workers, false, false, func(ctx context.Context, n int) (struct{}, error) {
+					bw.work(n)
+					return struct{}{}, nil
+				})
+				go func() {
+					defer p.Close()
+					for i := 0; i < benchJobs; i++ {
+						p.Submit(i)
+					}
+				}()
+				for range p.Results() {
+				}
+			}
+		})
+	}
+}
+
+// a cancelled pool must not leak its workers, even if Close() is never called
+func TestCancelWithoutClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := newPool(ctx, 4, 8, true, false, func(ctx context.Context, n int) (int, error) {
+		return n, nil
+	})
+	for i := 0; i < 3; i++ {
+		if err := p.Submit(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cancel()
+	results := 0
+	for range p.Results() { // closed only when all the workers have returned
+		results++
+	}
+	if results != 3 {
+		t.Errorf("got %d results, want 3", results)
+	}
+	if err := p.Submit(4); err == nil {
+		t.Error("Submit() after the cancellation succeeded")
+	}
+
+	// the goroutines of the pool need a moment to return after the results are closed
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines leaked", n-before)
+	}
+}